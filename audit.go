@@ -0,0 +1,112 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// Audit actions recorded in the audit collection
+const (
+	auditActionCreate    = "create"
+	auditActionUpdate    = "update"
+	auditActionDelete    = "delete"
+	auditActionRepair    = "repair"
+	auditActionReprocess = "reprocess"
+)
+
+// auditTimeout bounds an audit write so a slow audit collection cannot stall requests
+const auditTimeout = 5 * time.Second
+
+// auditEntry is a document in the audit collection
+type auditEntry struct {
+	ID         primitive.ObjectID `bson:"_id,omitempty" json:"id"`
+	Action     string             `bson:"action" json:"action"`
+	DocumentID string             `bson:"document_id" json:"document_id"`
+	Actor      string             `bson:"actor" json:"actor"`
+	RequestID  string             `bson:"request_id" json:"request_id"`
+	Timestamp  time.Time          `bson:"timestamp" json:"timestamp"`
+}
+
+// auditCollection returns the audit collection handle from the shared MongoDB client
+func auditCollection() *mongo.Collection {
+	return mongoClient.Database(dbName).Collection(auditCollName)
+}
+
+// recordAudit writes an audit entry for an action on a post. It is best-effort:
+// failures are logged and never fail the operation being audited.
+func recordAudit(c *gin.Context, action, documentID string) {
+	entry := auditEntry{
+		Action:     action,
+		DocumentID: documentID,
+		Actor:      adminSubject(c),
+		RequestID:  c.GetString(requestIDKey),
+		Timestamp:  time.Now(),
+	}
+
+	// Use a fresh context so the entry is still written if the client disconnects
+	ctx, cancel := context.WithTimeout(context.Background(), auditTimeout)
+	defer cancel()
+	if _, err := auditCollection().InsertOne(ctx, entry); err != nil {
+		log.Printf("Error writing audit entry (%s %s, request %s): %v", action, documentID, entry.RequestID, err)
+	}
+}
+
+// fetchAudit handles GET requests to page through audit entries, newest first
+func fetchAudit(c *gin.Context) {
+	page, ok := parsePagination(c)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid pagination parameters")
+		return
+	}
+
+	filter := bson.M{}
+	if action := c.Query("action"); action != "" {
+		filter["action"] = action
+	}
+	if documentID := c.Query("document_id"); documentID != "" {
+		filter["document_id"] = documentID
+	}
+
+	ctx := c.Request.Context()
+	total, err := auditCollection().CountDocuments(ctx, filter)
+	if err != nil {
+		log.Printf("Error counting audit entries in MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "timestamp", Value: -1}}).
+		SetSkip((page.Page - 1) * page.Limit).
+		SetLimit(page.Limit)
+	cursor, err := auditCollection().Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Error fetching audit entries from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	entries := []auditEntry{}
+	if err := cursor.All(ctx, &entries); err != nil {
+		log.Printf("Error parsing data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to parse data from MongoDB")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	respondList(c, http.StatusOK, "entries", entries, gin.H{"total": total, "page": page.Page, "limit": page.Limit})
+}
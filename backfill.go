@@ -0,0 +1,161 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// defaultBackfillLimit and maxBackfillLimit bound the posts handled by one backfill request
+	defaultBackfillLimit = 100
+	maxBackfillLimit     = 1000
+	// backfillBatchSize is how many posts are fetched and processed between progress logs
+	backfillBatchSize = 20
+)
+
+// withoutThumbnailFilter matches posts with no thumbnail yet
+var withoutThumbnailFilter = bson.M{"thumbnail_url": bson.M{"$exists": false}}
+
+// fetchPostsWithoutThumbnails handles GET requests listing posts that have no thumbnail_url
+func fetchPostsWithoutThumbnails(c *gin.Context) {
+	page, ok := parsePagination(c)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid pagination parameters")
+		return
+	}
+
+	results, total, err := findPostsPage(c.Request.Context(), postsCollectionFor(c.Request.Context()), withoutThumbnailFilter, page)
+	if err != nil {
+		log.Printf("Error fetching posts without thumbnails from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	respondList(c, http.StatusOK, "posts", toPostResponses(results), gin.H{"total": total, "page": page.Page, "limit": page.Limit})
+}
+
+// backfillResult summarises a thumbnail backfill run
+type backfillResult struct {
+	Processed int `json:"processed"`
+	Created   int `json:"created"`
+	Skipped   int `json:"skipped"`
+	Failed    int `json:"failed"`
+}
+
+// backfillThumbnails handles POST requests that generate thumbnails for up to ?limit=
+// image posts lacking one, in batches of backfillBatchSize
+func backfillThumbnails(c *gin.Context) {
+	limit := defaultBackfillLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxBackfillLimit)
+	}
+
+	// Posts stored before content_type was recorded are sniffed once their file is read
+	filter := bson.M{
+		"thumbnail_url": bson.M{"$exists": false},
+		"$or": bson.A{
+			bson.M{"content_type": bson.M{"$in": decodableImageTypes}},
+			bson.M{"content_type": bson.M{"$exists": false}},
+		},
+	}
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetBatchSize(backfillBatchSize)
+	ctx := c.Request.Context()
+	cursor, err := postsCollectionFor(ctx).Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Error fetching posts without thumbnails from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var result backfillResult
+	for cursor.Next(ctx) {
+		var doc postDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Error decoding post during thumbnail backfill: %v", err)
+			result.Failed++
+			continue
+		}
+
+		created, err := backfillThumbnail(ctx, doc)
+		switch {
+		case err != nil:
+			log.Printf("Error backfilling thumbnail for post %s: %v", doc.ID.Hex(), err)
+			result.Failed++
+		case created:
+			result.Created++
+		default:
+			result.Skipped++
+		}
+		result.Processed++
+		if result.Processed%backfillBatchSize == 0 {
+			log.Printf("Thumbnail backfill progress: %d processed, %d created, %d skipped, %d failed",
+				result.Processed, result.Created, result.Skipped, result.Failed)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error iterating posts during thumbnail backfill: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	log.Printf("Thumbnail backfill finished: %d processed, %d created, %d skipped, %d failed",
+		result.Processed, result.Created, result.Skipped, result.Failed)
+	respond(c, http.StatusOK, result, nil)
+}
+
+// backfillThumbnail generates and records the thumbnail of one post. It reports false
+// without an error when the stored file is not a decodable image.
+func backfillThumbnail(ctx context.Context, doc postDocument) (bool, error) {
+	key := objectKeyFor(doc)
+	object, err := storage.Get(ctx, key)
+	if err != nil {
+		return false, err
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil {
+		return false, err
+	}
+
+	file := bytes.NewReader(data)
+	contentType, err := detectContentType(file)
+	if err != nil {
+		return false, err
+	}
+	if !isDecodableImage(contentType) {
+		return false, nil
+	}
+	if err := checkImagePixels(file); err != nil {
+		return false, err
+	}
+
+	thumbnailURL, err := createThumbnail(ctx, file, key)
+	if err != nil {
+		return false, err
+	}
+	_, err = postsCollectionFor(ctx).UpdateOne(ctx, bson.M{"_id": doc.ID}, markModified(bson.M{"$set": bson.M{"thumbnail_url": thumbnailURL}}))
+	return err == nil, err
+}
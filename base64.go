@@ -0,0 +1,91 @@
+package main
+
+import (
+	"bytes"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// base64UploadRequest is the JSON body accepted by postSubmitBase64
+type base64UploadRequest struct {
+	Name          string `json:"name"`
+	Email         string `json:"email"`
+	PictureBase64 string `json:"picture_base64" binding:"required"`
+	Filename      string `json:"filename"`
+}
+
+var errBase64TooLarge = errors.New("decoded file exceeds the size limit")
+
+// postSubmitBase64 handles POST requests from legacy clients that send the image as base64
+// inside JSON; the decoded file goes through the same checks as a multipart upload
+func postSubmitBase64(c *gin.Context) {
+	ceiling := uploadCeiling()
+	if ceiling > 0 {
+		limit := int64(base64.StdEncoding.EncodedLen(int(ceiling))) + multipartOverheadBytes
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, limit)
+	}
+
+	var req base64UploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		recordError(c, errorCategoryValidation)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondError(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("Upload exceeds the maximum of %d bytes", ceiling))
+			return
+		}
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	data, err := decodeBase64File(req.PictureBase64, ceiling)
+	if errors.Is(err, errBase64TooLarge) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("Upload exceeds the maximum of %d bytes", ceiling))
+		return
+	}
+	if err != nil {
+		log.Printf("Error decoding base64 upload: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "picture_base64 is not valid base64")
+		return
+	}
+
+	filename := req.Filename
+	if filename == "" {
+		filename = "upload"
+	}
+	saveUpload(c, uploadMeta{Name: req.Name, Email: req.Email, Filename: filename}, bytes.NewReader(data))
+}
+
+// decodeBase64File decodes standard base64, optionally wrapped in a data: URI, reading at most
+// maxBytes decoded bytes when maxBytes is positive
+func decodeBase64File(encoded string, maxBytes int64) ([]byte, error) {
+	if strings.HasPrefix(encoded, "data:") {
+		if i := strings.Index(encoded, ";base64,"); i >= 0 {
+			encoded = encoded[i+len(";base64,"):]
+		}
+	}
+	var decoded io.Reader = base64.NewDecoder(base64.StdEncoding, strings.NewReader(encoded))
+	if maxBytes > 0 {
+		// Read one byte past the limit so oversized files are detected
+		decoded = io.LimitReader(decoded, maxBytes+1)
+	}
+	data, err := io.ReadAll(decoded)
+	if err != nil {
+		return nil, err
+	}
+	if len(data) == 0 {
+		return nil, errors.New("empty file")
+	}
+	if maxBytes > 0 && int64(len(data)) > maxBytes {
+		return nil, errBase64TooLarge
+	}
+	return data, nil
+}
@@ -0,0 +1,61 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// envInt reads an integer environment variable, falling back to def when unset
+func envInt(name string, def int) int {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	n, err := strconv.Atoi(value)
+	if err != nil {
+		log.Fatalf("%s must be an integer: %v", name, err)
+	}
+	return n
+}
+
+// envDuration reads a duration environment variable such as "10s", falling back to def when unset
+func envDuration(name string, def time.Duration) time.Duration {
+	value := os.Getenv(name)
+	if value == "" {
+		return def
+	}
+	d, err := time.ParseDuration(value)
+	if err != nil {
+		log.Fatalf("%s must be a duration such as 10s: %v", name, err)
+	}
+	return d
+}
+
+// clientConfig is the non-secret subset of the configuration the frontend validates against
+type clientConfig struct {
+	MaxUploadBytes    int64            `json:"max_upload_bytes"`
+	TypeSizeLimits    map[string]int64 `json:"type_size_limits"`
+	AllowedMIMETypes  []string         `json:"allowed_mime_types"`
+	AllowedExtensions []string         `json:"allowed_extensions"`
+	MaxFilesPerUpload int              `json:"max_files_per_upload"`
+}
+
+// fetchConfig handles GET /config. Limits of 0 and empty lists mean no restriction.
+func fetchConfig(c *gin.Context) {
+	config := clientConfig{
+		MaxUploadBytes:    maxUploadBytes,
+		TypeSizeLimits:    typeSizeLimits,
+		AllowedMIMETypes:  []string{},
+		AllowedExtensions: []string{},
+		// post-submit accepts exactly one file per request
+		MaxFilesPerUpload: 1,
+	}
+	config.AllowedMIMETypes = append(config.AllowedMIMETypes, allowedMIMETypes...)
+	config.AllowedExtensions = append(config.AllowedExtensions, allowedExtensions...)
+	c.JSON(http.StatusOK, config)
+}
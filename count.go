@@ -0,0 +1,89 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"golang.org/x/sync/singleflight"
+)
+
+// cachedCountEntry is a document count as of fetchedAt
+type cachedCountEntry struct {
+	count     int64
+	fetchedAt time.Time
+}
+
+var (
+	// countCache holds recent document counts keyed by collection and filter
+	countCache = struct {
+		sync.Mutex
+		entries map[string]cachedCountEntry
+	}{entries: map[string]cachedCountEntry{}}
+	// countGroup coalesces concurrent recomputations of the same count
+	countGroup singleflight.Group
+)
+
+// cachedCount returns CountDocuments for filter, cached for countCacheTTL. Concurrent
+// callers missing the cache share one query.
+func cachedCount(ctx context.Context, collection *mongo.Collection, filter bson.M) (int64, error) {
+	filterJSON, err := bson.MarshalExtJSON(filter, true, false)
+	if err != nil {
+		return 0, err
+	}
+	key := collection.Name() + ":" + string(filterJSON)
+
+	countCache.Lock()
+	entry, ok := countCache.entries[key]
+	countCache.Unlock()
+	if ok && time.Since(entry.fetchedAt) < countCacheTTL {
+		return entry.count, nil
+	}
+
+	// The shared query must not be cancelled just because the first caller went away
+	value, err, _ := countGroup.Do(key, func() (interface{}, error) {
+		count, err := collection.CountDocuments(context.WithoutCancel(ctx), filter)
+		if err != nil {
+			return int64(0), err
+		}
+		countCache.Lock()
+		countCache.entries[key] = cachedCountEntry{count: count, fetchedAt: time.Now()}
+		countCache.Unlock()
+		return count, nil
+	})
+	if err != nil {
+		return 0, err
+	}
+	return value.(int64), nil
+}
+
+// invalidateCounts drops every cached count after posts are inserted or deleted
+func invalidateCounts() {
+	countCache.Lock()
+	countCache.entries = map[string]cachedCountEntry{}
+	countCache.Unlock()
+}
+
+// fetchPostCount handles GET requests for the number of posts matching the list filters
+func fetchPostCount(c *gin.Context) {
+	filter, message, ok := parsePostFilter(c)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, message)
+		return
+	}
+
+	count, err := cachedCount(c.Request.Context(), postsCollectionFor(c.Request.Context()), filter)
+	if err != nil {
+		log.Printf("Error counting posts in MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	respond(c, http.StatusOK, gin.H{"count": count}, nil)
+}
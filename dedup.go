@@ -0,0 +1,50 @@
+package main
+
+import (
+	"context"
+	"errors"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// findDuplicate returns the oldest post whose content has the given SHA-256, or nil. Posts
+// whose file is still spooled, or was lost, are skipped since their object may never exist.
+func findDuplicate(ctx context.Context, contentSHA256 string) (*postDocument, error) {
+	var doc postDocument
+	filter := bson.M{"content_sha256": contentSHA256, "status": bson.M{"$exists": false}}
+	opts := options.FindOne().SetSort(bson.D{{Key: "created_at", Value: 1}, {Key: "_id", Value: 1}})
+	err := postsCollectionFor(ctx).FindOne(ctx, filter, opts).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	return &doc, nil
+}
+
+// duplicateOf returns the ID of the post an upload duplicated, or "" when it was new
+func duplicateOf(doc *postDocument) string {
+	if doc == nil {
+		return ""
+	}
+	return doc.ID.Hex()
+}
+
+// objectShared reports whether any post other than id references the object key.
+// Deduplicated uploads share one object, which must outlive all but the last post.
+func objectShared(ctx context.Context, key string, id primitive.ObjectID) (bool, error) {
+	count, err := postsCollectionFor(ctx).CountDocuments(ctx, bson.M{"object_key": key, "_id": bson.M{"$ne": id}})
+	return count > 0, err
+}
+
+// ensureContentHashIndex creates the content_sha256 index used to look up duplicates
+func ensureContentHashIndex(ctx context.Context) error {
+	_, err := postsCollectionFor(ctx).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "content_sha256", Value: 1}},
+	})
+	return err
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// deletePost handles DELETE requests that remove a post and, best-effort, its stored files
+func deletePost(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid post ID")
+		return
+	}
+
+	var doc postDocument
+	err = postsCollectionFor(c.Request.Context()).FindOneAndDelete(c.Request.Context(), bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error deleting post from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to delete data from MongoDB")
+		return
+	}
+	invalidateCounts()
+	recordAudit(c, auditActionDelete, doc.ID.Hex())
+
+	// The post is already gone, so storage failures only leave orphans behind.
+	// Objects still referenced by deduplicated posts are kept.
+	key := objectKeyFor(doc)
+	shared, err := objectShared(c.Request.Context(), key, doc.ID)
+	if err != nil {
+		log.Printf("Error checking other posts for object %s, keeping it: %v", key, err)
+	}
+	if err == nil && !shared {
+		if err := storage.Delete(c.Request.Context(), key); err != nil {
+			log.Printf("Error deleting object %s: %v", key, err)
+		}
+		if doc.ThumbnailURL != "" {
+			if err := storage.Delete(c.Request.Context(), thumbnailKey(key)); err != nil {
+				log.Printf("Error deleting thumbnail for %s: %v", key, err)
+			}
+		}
+		// Removing the spooled file also stops the retry worker from uploading it
+		if doc.Status == statusPendingUpload || doc.Status == statusUploadFailed {
+			removeSpooled(key)
+		}
+	}
+
+	respond(c, http.StatusOK, gin.H{"message": "Post deleted successfully", "id": doc.ID.Hex()}, nil)
+}
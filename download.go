@@ -0,0 +1,146 @@
+package main
+
+import (
+	"errors"
+	"io"
+	"log"
+	"mime"
+	"net/http"
+	"os"
+	"path"
+	"strconv"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// contentDisposition builds the Content-Disposition header for a download. ?download=true
+// forces an attachment, ?download=false forces inline, otherwise images display inline.
+func contentDisposition(c *gin.Context, doc postDocument, contentType string) string {
+	disposition := "attachment"
+	switch c.Query("download") {
+	case "true":
+	case "false":
+		disposition = "inline"
+	default:
+		if strings.HasPrefix(contentType, "image/") {
+			disposition = "inline"
+		}
+	}
+
+	filename := sanitizeFilename(doc.OriginalFilename)
+	if filename == "" {
+		filename = path.Base(objectKeyFor(doc))
+	} else if doc.OriginalType != "" {
+		// Converted uploads are served as WebP, so the suggested name should say so
+		filename = webpFilename(filename)
+	}
+	return mime.FormatMediaType(disposition, map[string]string{"filename": filename})
+}
+
+// downloadPost handles GET requests that proxy a post's file through the API
+func downloadPost(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid post ID")
+		return
+	}
+
+	var doc postDocument
+	err = postsCollectionFor(c.Request.Context()).FindOne(c.Request.Context(), bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching post from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	key := objectKeyFor(doc)
+
+	// Locally stored files are served straight from disk
+	if local, ok := storage.(*localStorage); ok {
+		filePath, err := local.path(key)
+		if err != nil {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusNotFound, codeNotFound, "File not found")
+			return
+		}
+		file, err := os.Open(filePath)
+		if err != nil {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusNotFound, codeNotFound, "File not found")
+			return
+		}
+		defer file.Close()
+		if doc.ContentType != "" {
+			c.Header("Content-Type", doc.ContentType)
+		}
+		c.Header("Content-Disposition", contentDisposition(c, doc, doc.ContentType))
+		http.ServeContent(c.Writer, c.Request, "", doc.CreatedAt, file)
+		return
+	}
+
+	// Byte ranges are passed through so clients can seek and resume through the proxy
+	input := &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	}
+	if rangeHeader := c.GetHeader("Range"); rangeHeader != "" {
+		input.Range = aws.String(rangeHeader)
+	}
+	object, err := s3Session.GetObjectWithContext(c.Request.Context(), input)
+	if isNotFound(err) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "File not found in S3")
+		return
+	}
+	if isInvalidRange(err) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusRequestedRangeNotSatisfiable, codeInvalidRequest, "Requested range is not satisfiable")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching object %s from S3: %v", key, err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to fetch file from S3")
+		return
+	}
+	defer object.Body.Close()
+
+	contentType := aws.StringValue(object.ContentType)
+	c.Header("Content-Type", contentType)
+	c.Header("Content-Disposition", contentDisposition(c, doc, contentType))
+	c.Header("Accept-Ranges", "bytes")
+	if object.ContentLength != nil {
+		c.Header("Content-Length", strconv.FormatInt(*object.ContentLength, 10))
+	}
+	status := http.StatusOK
+	if object.ContentRange != nil {
+		c.Header("Content-Range", *object.ContentRange)
+		status = http.StatusPartialContent
+	}
+	c.Status(status)
+	if _, err := io.Copy(c.Writer, object.Body); err != nil {
+		log.Printf("Error streaming object %s: %v", key, err)
+	}
+}
+
+// isInvalidRange reports whether an S3 error means the requested byte range is outside the object
+func isInvalidRange(err error) bool {
+	if rerr, ok := err.(awserr.RequestFailure); ok && rerr.StatusCode() == http.StatusRequestedRangeNotSatisfiable {
+		return true
+	}
+	aerr, ok := err.(awserr.Error)
+	return ok && aerr.Code() == "InvalidRange"
+}
@@ -0,0 +1,67 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// postsETag computes a weak ETag for the post list from the document count, the latest
+// created_at and the latest modified_at, so inserts, deletes and updates all change it
+func postsETag(ctx context.Context, collection *mongo.Collection) (string, error) {
+	count, err := cachedCount(ctx, collection, bson.M{})
+	if err != nil {
+		return "", err
+	}
+
+	var latest postDocument
+	opts := options.FindOne().SetSort(bson.M{"created_at": -1}).SetProjection(bson.M{"created_at": 1})
+	err = collection.FindOne(ctx, bson.M{}, opts).Decode(&latest)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", err
+	}
+
+	var modified struct {
+		ModifiedAt time.Time `bson:"modified_at"`
+	}
+	opts = options.FindOne().SetSort(bson.M{"modified_at": -1}).SetProjection(bson.M{"modified_at": 1})
+	err = collection.FindOne(ctx, bson.M{"modified_at": bson.M{"$exists": true}}, opts).Decode(&modified)
+	if err != nil && !errors.Is(err, mongo.ErrNoDocuments) {
+		return "", err
+	}
+
+	return fmt.Sprintf(`W/"%d-%d-%d"`, count, latest.CreatedAt.UnixNano(), modified.ModifiedAt.UnixNano()), nil
+}
+
+// markModified stamps modified_at on an update to a post; every post update goes through it
+// so the list ETag changes with it
+func markModified(update bson.M) bson.M {
+	update["$currentDate"] = bson.M{"modified_at": true}
+	return update
+}
+
+// ensureModifiedIndex creates the modified_at index that keeps postsETag from scanning the collection
+func ensureModifiedIndex(ctx context.Context) error {
+	_, err := postsCollectionFor(ctx).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "modified_at", Value: -1}},
+	})
+	return err
+}
+
+// etagMatches reports whether an If-None-Match header value matches the given ETag
+func etagMatches(ifNoneMatch, etag string) bool {
+	for _, candidate := range strings.Split(ifNoneMatch, ",") {
+		candidate = strings.TrimSpace(candidate)
+		// Weak comparison ignores the W/ prefix on either side
+		if candidate == "*" || strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,19 @@
+package main
+
+import (
+	"context"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// ensureExpiryIndex creates a TTL index on expires_at so MongoDB deletes each post once its
+// expiry date passes. Posts without expires_at are kept.
+func ensureExpiryIndex(ctx context.Context) error {
+	_, err := postsCollectionFor(ctx).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys:    bson.D{{Key: "expires_at", Value: 1}},
+		Options: options.Index().SetExpireAfterSeconds(0),
+	})
+	return err
+}
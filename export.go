@@ -0,0 +1,203 @@
+package main
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/csv"
+	"encoding/json"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// exportPostsZip handles GET requests to stream every stored image as a ZIP archive
+func exportPostsZip(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Archive export requires the S3 storage backend")
+		return
+	}
+
+	ctx := c.Request.Context()
+	collection := postsCollectionFor(ctx)
+
+	cursor, err := collection.Find(ctx, bson.M{})
+	if err != nil {
+		log.Printf("Error fetching data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	c.Header("Content-Type", "application/zip")
+	c.Header("Content-Disposition", `attachment; filename="posts-export.zip"`)
+	c.Status(http.StatusOK)
+
+	zw := zip.NewWriter(c.Writer)
+	for cursor.Next(ctx) {
+		var doc postDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Error parsing data from MongoDB: %v", err)
+			continue
+		}
+		key := objectKeyFor(doc)
+		if key == "" {
+			log.Printf("Skipping post %s in export: no object key", doc.ID.Hex())
+			continue
+		}
+
+		skipped, err := writeZipEntry(ctx, zw, key)
+		if err != nil {
+			// The response is already streaming, so leave the archive without a
+			// central directory; clients will see it as truncated rather than complete.
+			log.Printf("Error exporting object %s: %v", key, err)
+			return
+		}
+		if skipped {
+			log.Printf("Skipping object %s in export: not found in S3", key)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error iterating posts for export: %v", err)
+		return
+	}
+
+	if err := zw.Close(); err != nil {
+		log.Printf("Error finalizing export archive: %v", err)
+	}
+}
+
+// writeZipEntry copies a single S3 object into the archive, reporting whether it was skipped as missing
+func writeZipEntry(ctx context.Context, zw *zip.Writer, key string) (bool, error) {
+	object, err := s3Session.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		if aerr, ok := err.(awserr.Error); ok && aerr.Code() == s3.ErrCodeNoSuchKey {
+			return true, nil
+		}
+		return false, err
+	}
+	defer object.Body.Close()
+
+	header := &zip.FileHeader{Name: key, Method: zip.Deflate}
+	if object.LastModified != nil {
+		header.Modified = *object.LastModified
+	}
+	entry, err := zw.CreateHeader(header)
+	if err != nil {
+		return false, err
+	}
+	_, err = io.Copy(entry, object.Body)
+	return false, err
+}
+
+// Export formats selected by the Accept header of GET /admin/posts/export
+const (
+	mimeCSV    = "text/csv"
+	mimeNDJSON = "application/x-ndjson"
+)
+
+// exportColumns are the CSV columns of GET /admin/posts/export
+var exportColumns = []string{"id", "name", "email", "picture", "original_filename", "content_type", "size_bytes", "created_at"}
+
+// exportPosts handles GET requests to stream post metadata as JSON, CSV or NDJSON,
+// chosen from the Accept header. JSON is the default when any format is acceptable.
+func exportPosts(c *gin.Context) {
+	format := c.NegotiateFormat(gin.MIMEJSON, mimeCSV, mimeNDJSON)
+	if format == "" {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotAcceptable, codeNotAcceptable, "Export is available as application/json, text/csv or application/x-ndjson")
+		return
+	}
+
+	ctx := c.Request.Context()
+	cursor, err := postsCollectionFor(ctx).Find(ctx, bson.M{}, options.Find().SetSort(bson.D{{Key: "_id", Value: 1}}))
+	if err != nil {
+		log.Printf("Error fetching data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	c.Header("Vary", "Accept")
+	switch format {
+	case mimeCSV:
+		exportPostsCSV(c, cursor)
+	case mimeNDJSON:
+		exportPostsNDJSON(c, cursor)
+	default:
+		streamPostsJSON(c, cursor, nil)
+	}
+}
+
+// exportPostsCSV writes the cursor's posts as CSV with a header row
+func exportPostsCSV(c *gin.Context, cursor *mongo.Cursor) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", mimeCSV+"; charset=utf-8")
+	c.Header("Content-Disposition", `attachment; filename="posts-export.csv"`)
+	c.Status(http.StatusOK)
+
+	w := csv.NewWriter(c.Writer)
+	w.Write(exportColumns)
+	for cursor.Next(ctx) {
+		var doc postDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Error parsing data from MongoDB: %v", err)
+			continue
+		}
+		err := w.Write([]string{
+			doc.ID.Hex(),
+			doc.Name,
+			readEmail(doc.Email),
+			publicURL(objectKeyFor(doc), doc.Picture),
+			sanitizeFilename(doc.OriginalFilename),
+			doc.ContentType,
+			strconv.FormatInt(doc.SizeBytes, 10),
+			doc.CreatedAt.UTC().Format(time.RFC3339),
+		})
+		if err != nil {
+			log.Printf("Error writing CSV export, client likely disconnected: %v", err)
+			return
+		}
+	}
+	if err := cursor.Err(); err != nil && ctx.Err() == nil {
+		log.Printf("Error iterating posts for export: %v", err)
+	}
+	w.Flush()
+}
+
+// exportPostsNDJSON writes the cursor's posts as newline-delimited JSON, one post per line
+func exportPostsNDJSON(c *gin.Context, cursor *mongo.Cursor) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", mimeNDJSON)
+	c.Status(http.StatusOK)
+
+	encoder := json.NewEncoder(c.Writer)
+	for cursor.Next(ctx) {
+		var doc postDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Error parsing data from MongoDB: %v", err)
+			continue
+		}
+		if err := encoder.Encode(toPostResponse(doc)); err != nil {
+			log.Printf("Error writing NDJSON export, client likely disconnected: %v", err)
+			return
+		}
+	}
+	if err := cursor.Err(); err != nil && ctx.Err() == nil {
+		log.Printf("Error iterating posts for export: %v", err)
+	}
+}
@@ -0,0 +1,104 @@
+package main
+
+import (
+	"encoding/json"
+	"fmt"
+	"sort"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// postFields maps each selectable response field to the document fields it is built from.
+// picture and thumbnailUrl need object_key as well so PUBLIC_BASE_URL can be applied.
+var postFields = map[string][]string{
+	"id":               {"_id"},
+	"name":             {"name"},
+	"email":            {"email"},
+	"picture":          {"picture", "object_key"},
+	"thumbnailUrl":     {"thumbnail_url", "picture", "object_key"},
+	"originalFilename": {"original_filename"},
+	"width":            {"width"},
+	"height":           {"height"},
+	"blurhash":         {"blurhash"},
+	"status":           {"status"},
+	"pageCount":        {"page_count"},
+	"views":            {"views"},
+	"location":         {"location"},
+	"metadata":         {"metadata"},
+	"createdAt":        {"created_at"},
+	"updatedAt":        {"updated_at"},
+}
+
+// parseFields reads ?fields= into the response fields to return and a MongoDB projection.
+// It returns nil fields when the parameter is absent, and a message for unknown names.
+func parseFields(c *gin.Context) ([]string, bson.M, string, bool) {
+	value := c.Query("fields")
+	if value == "" {
+		return nil, nil, "", true
+	}
+
+	fields := []string{"id"}
+	projection := bson.M{"_id": 1}
+	for _, field := range splitList(value) {
+		sources, ok := postFields[field]
+		if !ok {
+			return nil, nil, fmt.Sprintf("Unknown field %q; valid fields are %s", field, strings.Join(postFieldNames(), ", ")), false
+		}
+		if field != "id" {
+			fields = append(fields, field)
+		}
+		for _, source := range sources {
+			projection[source] = 1
+		}
+	}
+	return fields, projection, "", true
+}
+
+// postFieldNames returns the selectable field names, sorted, built from postFields so the
+// list cannot fall behind it
+func postFieldNames() []string {
+	names := make([]string, 0, len(postFields))
+	for name := range postFields {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// selectFields returns only the requested fields of a post response
+func selectFields(response PostResponse, fields []string) (gin.H, error) {
+	encoded, err := json.Marshal(response)
+	if err != nil {
+		return nil, err
+	}
+	var all map[string]json.RawMessage
+	if err := json.Unmarshal(encoded, &all); err != nil {
+		return nil, err
+	}
+
+	selected := gin.H{}
+	for _, field := range fields {
+		if value, ok := all[field]; ok {
+			selected[field] = value
+		}
+	}
+	return selected, nil
+}
+
+// projectedPostResponses converts documents into API representations, limited to fields when set
+func projectedPostResponses(docs []postDocument, fields []string) (any, error) {
+	if fields == nil {
+		return toPostResponses(docs), nil
+	}
+	responses := make([]gin.H, 0, len(docs))
+	for _, doc := range docs {
+		selected, err := selectFields(toPostResponse(doc), fields)
+		if err != nil {
+			return nil, err
+		}
+		responses = append(responses, selected)
+	}
+	return responses, nil
+}
@@ -0,0 +1,69 @@
+package main
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxFilterLength caps the length of search and filter parameters
+const maxFilterLength = 100
+
+// validateFilterParam checks a search parameter's length and characters,
+// returning a client-facing message when it is rejected
+func validateFilterParam(name, value string) (string, bool) {
+	if utf8.RuneCountInString(value) > maxFilterLength {
+		return fmt.Sprintf("%s must be at most %d characters", name, maxFilterLength), false
+	}
+	if !utf8.ValidString(value) || strings.IndexFunc(value, unicode.IsControl) >= 0 {
+		return fmt.Sprintf("%s contains invalid characters", name), false
+	}
+	return value, true
+}
+
+// containsRegex builds a case-insensitive substring match with regex metacharacters escaped
+func containsRegex(value string) primitive.Regex {
+	return primitive.Regex{Pattern: regexp.QuoteMeta(value), Options: "i"}
+}
+
+// parsePostFilter builds a MongoDB filter from the name, email and q query parameters.
+// name and email match their fields; q matches name, email or the original filename.
+// Encrypted emails cannot be searched by substring, so with ENCRYPT_PII they match exactly.
+func parsePostFilter(c *gin.Context) (bson.M, string, bool) {
+	filter := bson.M{}
+	for _, field := range []string{"name", "email"} {
+		value := c.Query(field)
+		if value == "" {
+			continue
+		}
+		if message, ok := validateFilterParam(field, value); !ok {
+			return nil, message, false
+		}
+		if field == "email" && encryptPII {
+			filter["$and"] = bson.A{emailMatch(value)}
+			continue
+		}
+		filter[field] = containsRegex(value)
+	}
+	if q := c.Query("q"); q != "" {
+		if message, ok := validateFilterParam("q", q); !ok {
+			return nil, message, false
+		}
+		emailCondition := bson.M{"email": containsRegex(q)}
+		if encryptPII {
+			emailCondition = emailMatch(q)
+		}
+		filter["$or"] = bson.A{
+			bson.M{"name": containsRegex(q)},
+			emailCondition,
+			bson.M{"original_filename": containsRegex(q)},
+		}
+	}
+	return filter, "", true
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"github.com/rwcarlsen/goexif/exif"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// maxNearRadiusKm caps the radius accepted by fetchPostsNear, about half the Earth's circumference
+const maxNearRadiusKm = 20000
+
+// geoPoint is a GeoJSON point; Coordinates are [longitude, latitude]
+type geoPoint struct {
+	Type        string    `bson:"type" json:"type"`
+	Coordinates []float64 `bson:"coordinates" json:"coordinates"`
+}
+
+// newGeoPoint returns the GeoJSON point for a latitude and longitude
+func newGeoPoint(lat, lng float64) *geoPoint {
+	return &geoPoint{Type: "Point", Coordinates: []float64{lng, lat}}
+}
+
+// extractGPS reads the GPS position from a JPEG's EXIF data and rewinds the file.
+// ok is false when the image carries no usable GPS tags.
+func extractGPS(file io.ReadSeeker) (location *geoPoint, ok bool, err error) {
+	x, decodeErr := exif.Decode(file)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, false, err
+	}
+	if decodeErr != nil {
+		return nil, false, nil
+	}
+	lat, lng, err := x.LatLong()
+	if err != nil {
+		return nil, false, nil
+	}
+	if lat < -90 || lat > 90 || lng < -180 || lng > 180 {
+		return nil, false, nil
+	}
+	return newGeoPoint(lat, lng), true, nil
+}
+
+// ensureLocationIndex creates the 2dsphere index used by location queries
+func ensureLocationIndex(ctx context.Context) error {
+	_, err := postsCollectionFor(ctx).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "location", Value: "2dsphere"}},
+	})
+	return err
+}
+
+// parseCoordinate parses a query parameter as a float within [lo, hi]
+func parseCoordinate(value string, lo, hi float64) (float64, bool) {
+	f, err := strconv.ParseFloat(value, 64)
+	if err != nil || f < lo || f > hi {
+		return 0, false
+	}
+	return f, true
+}
+
+// fetchPostsNear handles GET requests for posts within radius_km of lat/lng, nearest first.
+// Only posts with a stored location can match.
+func fetchPostsNear(c *gin.Context) {
+	lat, ok := parseCoordinate(c.Query("lat"), -90, 90)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "lat must be a number between -90 and 90")
+		return
+	}
+	lng, ok := parseCoordinate(c.Query("lng"), -180, 180)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "lng must be a number between -180 and 180")
+		return
+	}
+	radiusKm, ok := parseCoordinate(c.Query("radius_km"), 0, maxNearRadiusKm)
+	if !ok || radiusKm == 0 {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "radius_km must be a positive number of at most 20000")
+		return
+	}
+	page, ok := parsePagination(c)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid pagination parameters")
+		return
+	}
+
+	// $near sorts by distance itself, so no explicit sort is applied
+	filter := bson.M{"location": bson.M{"$near": bson.M{
+		"$geometry":    newGeoPoint(lat, lng),
+		"$maxDistance": radiusKm * 1000,
+	}}}
+	opts := options.Find().SetSkip((page.Page - 1) * page.Limit).SetLimit(page.Limit)
+	cursor, err := postsCollectionFor(c.Request.Context()).Find(c.Request.Context(), filter, opts)
+	if err != nil {
+		log.Printf("Error fetching nearby posts from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var results []postDocument
+	if err := cursor.All(c.Request.Context(), &results); err != nil {
+		log.Printf("Error parsing data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to parse data from MongoDB")
+		return
+	}
+
+	respondList(c, http.StatusOK, "posts", toPostResponses(results), gin.H{"count": len(results), "page": page.Page, "limit": page.Limit})
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"sync/atomic"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+	"go.mongodb.org/mongo-driver/x/mongo/driver/topology"
+)
+
+// readinessTimeout bounds how long each dependency check may take
+const readinessTimeout = 2 * time.Second
+
+// mongoHealthy is maintained by monitorMongoHealth and reported by readyz
+var mongoHealthy atomic.Bool
+
+// monitorMongoHealth pings MongoDB every interval, updating mongoHealthy and logging transitions
+func monitorMongoHealth(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+		err := mongoClient.Ping(ctx, readpref.Primary())
+		cancel()
+
+		healthy := err == nil
+		if previous := mongoHealthy.Swap(healthy); previous != healthy {
+			if healthy {
+				log.Println("MongoDB is healthy")
+			} else {
+				log.Printf("MongoDB is unhealthy: %v", err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// healthProbeKey is the object written and deleted by the DEEP_HEALTH write probe
+const healthProbeKey = "healthcheck/probe"
+
+// s3Writable is maintained by monitorS3Writes and reported by readyz when DEEP_HEALTH is on
+var s3Writable atomic.Bool
+
+// monitorS3Writes puts and deletes healthProbeKey every interval, updating s3Writable and
+// logging transitions, so readiness also covers credentials and bucket policy for writes
+func monitorS3Writes(interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		ctx, cancel := context.WithTimeout(context.Background(), readinessTimeout)
+		_, err := s3Session.PutObjectWithContext(ctx, &s3.PutObjectInput{
+			Bucket: aws.String(bucket),
+			Key:    aws.String(healthProbeKey),
+			Body:   bytes.NewReader([]byte("ok")),
+		})
+		if err == nil {
+			_, err = s3Session.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+				Bucket: aws.String(bucket),
+				Key:    aws.String(healthProbeKey),
+			})
+		}
+		cancel()
+
+		healthy := err == nil
+		if previous := s3Writable.Swap(healthy); previous != healthy {
+			if healthy {
+				log.Println("S3 is writable")
+			} else {
+				log.Printf("S3 write probe failed: %v", err)
+			}
+		}
+		<-ticker.C
+	}
+}
+
+// healthz handles liveness probes; it succeeds as long as the process is serving requests
+func healthz(c *gin.Context) {
+	c.JSON(http.StatusOK, gin.H{"status": "ok"})
+}
+
+// readyz handles readiness probes by checking that MongoDB and S3 are reachable
+func readyz(c *gin.Context) {
+	ctx, cancel := context.WithTimeout(c.Request.Context(), readinessTimeout)
+	defer cancel()
+
+	ready := true
+	checks := gin.H{"mongo": "ok", "s3": "ok"}
+
+	if !mongoHealthy.Load() {
+		checks["mongo"] = "unavailable"
+		ready = false
+	}
+
+	if storageBackend == "s3" {
+		_, err := s3Session.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+		if err != nil {
+			log.Printf("Readiness check failed for S3: %v", err)
+			checks["s3"] = "unavailable"
+			ready = false
+		}
+	} else {
+		delete(checks, "s3")
+	}
+
+	if deepHealth && storageBackend == "s3" {
+		checks["s3_write"] = "ok"
+		if !s3Writable.Load() {
+			checks["s3_write"] = "unavailable"
+			ready = false
+		}
+	}
+
+	if !ready {
+		c.JSON(http.StatusServiceUnavailable, gin.H{"status": "unavailable", "checks": checks})
+		return
+	}
+	c.JSON(http.StatusOK, gin.H{"status": "ok", "checks": checks})
+}
+
+// isServerSelectionError reports whether err means no suitable MongoDB server, such as a
+// primary for writes, could be selected before MONGO_SERVER_SELECTION_TIMEOUT
+func isServerSelectionError(err error) bool {
+	var selectionErr topology.ServerSelectionError
+	return errors.As(err, &selectionErr)
+}
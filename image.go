@@ -0,0 +1,123 @@
+package main
+
+import (
+	"bytes"
+	"crypto/md5"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"image"
+	"image/jpeg"
+	"io"
+	"net/http"
+
+	"github.com/buckket/go-blurhash"
+	"github.com/disintegration/imaging"
+)
+
+// detectContentType sniffs the content type of a file and rewinds it
+func detectContentType(file io.ReadSeeker) (string, error) {
+	buffer := make([]byte, 512)
+	n, err := file.Read(buffer)
+	if err != nil && err != io.EOF {
+		return "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	return http.DetectContentType(buffer[:n]), nil
+}
+
+// fileDigests returns the hex MD5 and SHA-256 digests of a file and rewinds it
+func fileDigests(file io.ReadSeeker) (md5Hex, sha256Hex string, err error) {
+	md5Hash, sha256Hash := md5.New(), sha256.New()
+	if _, err := io.Copy(io.MultiWriter(md5Hash, sha256Hash), file); err != nil {
+		return "", "", err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", "", err
+	}
+	return hex.EncodeToString(md5Hash.Sum(nil)), hex.EncodeToString(sha256Hash.Sum(nil)), nil
+}
+
+// decodableImageTypes lists the sniffed content types that can be decoded as raster images
+var decodableImageTypes = []string{"image/jpeg", "image/png", "image/gif", "image/bmp", "image/webp"}
+
+// isDecodableImage reports whether a content type can be decoded as a raster image
+func isDecodableImage(contentType string) bool {
+	return containsString(decodableImageTypes, mediaType(contentType))
+}
+
+// imageDimensions reads the width and height from an image header without decoding
+// the pixels, then rewinds the file. ok is false for files that are not decodable images.
+func imageDimensions(file io.ReadSeeker) (width, height int, ok bool, err error) {
+	config, _, decodeErr := image.DecodeConfig(file)
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, 0, false, err
+	}
+	if decodeErr != nil {
+		return 0, 0, false, nil
+	}
+	return config.Width, config.Height, true, nil
+}
+
+// imageTooSmall reports whether an image is narrower than MIN_IMAGE_WIDTH or shorter than MIN_IMAGE_HEIGHT
+func imageTooSmall(width, height int) bool {
+	return width < minImageWidth || height < minImageHeight
+}
+
+// errImageTooLarge is returned when an image header declares more than maxImagePixels pixels
+var errImageTooLarge = errors.New("image exceeds the maximum pixel count")
+
+// checkImagePixels rejects images whose header declares more than maxImagePixels pixels,
+// so decompression bombs are caught before any full decode. The file is rewound.
+func checkImagePixels(file io.ReadSeeker) error {
+	width, height, ok, err := imageDimensions(file)
+	if err != nil {
+		return err
+	}
+	if ok && maxImagePixels > 0 && int64(width)*int64(height) > maxImagePixels {
+		return errImageTooLarge
+	}
+	return nil
+}
+
+// normalizeImageOrientation applies the EXIF orientation of a JPEG and
+// re-encodes it, which also strips the EXIF block. Other files are returned untouched.
+func normalizeImageOrientation(file io.ReadSeeker) (io.ReadSeeker, error) {
+	contentType, err := detectContentType(file)
+	if err != nil {
+		return nil, err
+	}
+	if contentType != "image/jpeg" {
+		return file, nil
+	}
+
+	img, err := imaging.Decode(file, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	if err := jpeg.Encode(&out, img, &jpeg.Options{Quality: 92}); err != nil {
+		return nil, err
+	}
+	return bytes.NewReader(out.Bytes()), nil
+}
+
+// blurhashSize is the edge length images are shrunk to before hashing; the placeholder
+// is blurry anyway, so a tiny image gives the same hash far faster
+const blurhashSize = 32
+
+// computeBlurhash returns the blurhash placeholder of an image and rewinds the file
+func computeBlurhash(file io.ReadSeeker) (string, error) {
+	img, err := imaging.Decode(file)
+	if _, seekErr := file.Seek(0, io.SeekStart); seekErr != nil {
+		return "", seekErr
+	}
+	if err != nil {
+		return "", err
+	}
+	small := imaging.Fit(img, blurhashSize, blurhashSize, imaging.Box)
+	return blurhash.Encode(4, 3, small)
+}
@@ -0,0 +1,41 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+)
+
+func TestImageTooSmall(t *testing.T) {
+	previousWidth, previousHeight := minImageWidth, minImageHeight
+	minImageWidth, minImageHeight = 100, 50
+	defer func() { minImageWidth, minImageHeight = previousWidth, previousHeight }()
+
+	tests := []struct {
+		name          string
+		width, height int
+		want          bool
+	}{
+		{"exactly the minimum", 100, 50, false},
+		{"larger", 640, 480, false},
+		{"too narrow", 99, 480, true},
+		{"too short", 640, 49, true},
+		{"both too small", 10, 10, true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var buf bytes.Buffer
+			if err := png.Encode(&buf, image.NewGray(image.Rect(0, 0, tt.width, tt.height))); err != nil {
+				t.Fatal(err)
+			}
+			width, height, ok, err := imageDimensions(bytes.NewReader(buf.Bytes()))
+			if err != nil || !ok {
+				t.Fatalf("imageDimensions = %v, %v", ok, err)
+			}
+			if got := imageTooSmall(width, height); got != tt.want {
+				t.Errorf("imageTooSmall(%d, %d) = %v, want %v", width, height, got, tt.want)
+			}
+		})
+	}
+}
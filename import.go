@@ -0,0 +1,112 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// maxImportBatch caps the records accepted by one import request
+const maxImportBatch = 1000
+
+// importRecord is one entry of the POST /admin/posts/import body
+type importRecord struct {
+	Name    string `json:"name"`
+	Email   string `json:"email"`
+	Picture string `json:"picture"`
+}
+
+// importRejection reports why the record at Index was not imported
+type importRejection struct {
+	Index int    `json:"index"`
+	Error string `json:"error"`
+}
+
+// validateImportRecord returns a message describing what is wrong with a record, or ""
+func validateImportRecord(record importRecord) string {
+	if strings.TrimSpace(record.Name) == "" {
+		return "name is required"
+	}
+	if !validEmail(record.Email) {
+		return "email must be a valid email address"
+	}
+	u, err := url.Parse(record.Picture)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return "picture must be an http or https URL"
+	}
+	return ""
+}
+
+// importPosts handles POST requests inserting a batch of posts whose files are already
+// stored, with a single InsertMany. Any invalid record rejects the whole batch unless
+// ?partial=true, which imports the valid records and reports the rest.
+func importPosts(c *gin.Context) {
+	var records []importRecord
+	if err := c.ShouldBindJSON(&records); err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Request body must be a JSON array of posts")
+		return
+	}
+	if len(records) == 0 || len(records) > maxImportBatch {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Batch must contain between 1 and %d posts", maxImportBatch))
+		return
+	}
+	partial := c.Query("partial") == "true"
+
+	now := time.Now()
+	documents := make([]interface{}, 0, len(records))
+	rejected := []importRejection{}
+	for i, record := range records {
+		if message := validateImportRecord(record); message != "" {
+			rejected = append(rejected, importRejection{Index: i, Error: message})
+			continue
+		}
+		document, err := emailFields(record.Email)
+		if err != nil {
+			log.Printf("Error encrypting email: %v", err)
+			recordError(c, errorCategoryMongo)
+			respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to save data to MongoDB")
+			return
+		}
+		document["name"] = record.Name
+		document["picture"] = record.Picture
+		document["created_at"] = now
+		if key, ok := strings.CutPrefix(record.Picture, s3URLPrefix()); ok && key != "" {
+			document["object_key"] = key
+		}
+		documents = append(documents, document)
+	}
+	if len(rejected) > 0 && !partial {
+		recordError(c, errorCategoryValidation)
+		respondErrorDetails(c, http.StatusUnprocessableEntity, codeInvalidRequest, "Batch contains invalid posts; nothing was imported", gin.H{"rejected": rejected})
+		return
+	}
+
+	insertedIDs := []string{}
+	if len(documents) > 0 {
+		result, err := postsCollectionFor(c.Request.Context()).InsertMany(c.Request.Context(), documents)
+		if err != nil {
+			log.Printf("Error importing posts into MongoDB: %v", err)
+			recordError(c, errorCategoryMongo)
+			respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to save data to MongoDB")
+			return
+		}
+		invalidateCounts()
+		for _, insertedID := range result.InsertedIDs {
+			if id, ok := insertedID.(primitive.ObjectID); ok {
+				insertedIDs = append(insertedIDs, id.Hex())
+				recordAudit(c, auditActionCreate, id.Hex())
+			}
+		}
+	}
+
+	log.Printf("Imported %d posts, rejected %d", len(insertedIDs), len(rejected))
+	respond(c, http.StatusOK, gin.H{"inserted_ids": insertedIDs, "rejected": rejected}, nil)
+}
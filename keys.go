@@ -0,0 +1,121 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"path/filepath"
+	"strings"
+	"text/template"
+	"time"
+
+	"github.com/google/uuid"
+)
+
+// defaultKeyTemplate reproduces the original timestamp-prefixed key layout
+const defaultKeyTemplate = "{{.Timestamp}}-{{.OriginalName}}"
+
+// keyTemplate is parsed from S3_KEY_TEMPLATE at startup
+var keyTemplate *template.Template
+
+// keyData holds the variables available to S3_KEY_TEMPLATE
+type keyData struct {
+	UUID         string
+	Ext          string
+	Date         string
+	Timestamp    string
+	OriginalName string
+	SHA256       string
+}
+
+// newKeyData returns the template variables for a file uploaded now. SHA256 falls back
+// to the UUID when the content is not known up front, as for presigned uploads.
+func newKeyData(originalName, contentSHA256 string) keyData {
+	now := time.Now()
+	id := uuid.NewString()
+	if contentSHA256 == "" {
+		contentSHA256 = id
+	}
+	return keyData{
+		UUID:         id,
+		SHA256:       contentSHA256,
+		Ext:          strings.ToLower(filepath.Ext(originalName)),
+		Date:         now.Format("2006-01-02"),
+		Timestamp:    now.Format("20060102150405"),
+		OriginalName: originalName,
+	}
+}
+
+// parseKeyTemplate parses a key template and checks it renders a usable key
+func parseKeyTemplate(text string) (*template.Template, error) {
+	tmpl, err := template.New("key").Option("missingkey=error").Parse(text)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := renderKey(tmpl, newKeyData("example.jpg", "")); err != nil {
+		return nil, err
+	}
+	return tmpl, nil
+}
+
+// renderKey executes a key template, rejecting empty keys
+func renderKey(tmpl *template.Template, data keyData) (string, error) {
+	var b strings.Builder
+	if err := tmpl.Execute(&b, data); err != nil {
+		return "", err
+	}
+	key := strings.TrimLeft(b.String(), "/")
+	if key == "" {
+		return "", errors.New("key template produced an empty key")
+	}
+	return key, nil
+}
+
+// contentAddressedKeys is set when S3_KEY_TEMPLATE derives keys from the content hash
+var contentAddressedKeys bool
+
+// usesContentHash reports whether a key template references the SHA256 variable
+func usesContentHash(text string) bool {
+	return strings.Contains(text, ".SHA256")
+}
+
+// buildKey returns the storage key for an uploaded file using S3_KEY_TEMPLATE, under the
+// request tenant's prefix when there is one
+func buildKey(ctx context.Context, originalName, contentSHA256 string) (string, error) {
+	key, err := renderKey(keyTemplate, newKeyData(originalName, contentSHA256))
+	if err != nil {
+		return "", err
+	}
+	return tenantPrefix(ctx) + key, nil
+}
+
+// tenantKeyPrefix is the top-level S3 prefix holding every tenant's objects
+const tenantKeyPrefix = "tenants/"
+
+// tenantPrefix returns the key prefix of the request tenant, or "" for the default layout
+func tenantPrefix(ctx context.Context) string {
+	if tenant := tenantFromContext(ctx); tenant != "" {
+		return tenantKeyPrefix + tenant + "/"
+	}
+	return ""
+}
+
+// keyInTenant reports whether a client-supplied key belongs to the request tenant:
+// under its prefix for a tenant, and outside tenants/ for the default layout
+func keyInTenant(ctx context.Context, key string) bool {
+	if prefix := tenantPrefix(ctx); prefix != "" {
+		return strings.HasPrefix(key, prefix)
+	}
+	return len(tenants) == 0 || !strings.HasPrefix(key, tenantKeyPrefix)
+}
+
+// splitTenantKey splits a key into its tenant prefix, if any, and the rest of the key
+func splitTenantKey(key string) (prefix, rest string) {
+	if !strings.HasPrefix(key, tenantKeyPrefix) {
+		return "", key
+	}
+	tenant, rest, ok := strings.Cut(strings.TrimPrefix(key, tenantKeyPrefix), "/")
+	if !ok {
+		return "", key
+	}
+	return tenantKeyPrefix + tenant + "/", rest
+}
@@ -0,0 +1,29 @@
+package main
+
+import (
+	"context"
+	"time"
+
+	"golang.org/x/sync/semaphore"
+)
+
+// uploadSlots caps the number of uploads streaming to storage at once; nil means unlimited
+var uploadSlots *semaphore.Weighted
+
+// acquireUploadSlot waits up to uploadSlotTimeout for an upload slot. The returned
+// release function must be called once the upload finishes; ok is false when no slot was free.
+func acquireUploadSlot(ctx context.Context) (release func(), ok bool) {
+	if uploadSlots == nil {
+		return func() {}, true
+	}
+
+	ctx, cancel := context.WithTimeout(ctx, uploadSlotTimeout)
+	defer cancel()
+	if err := uploadSlots.Acquire(ctx, 1); err != nil {
+		return nil, false
+	}
+	return func() { uploadSlots.Release(1) }, true
+}
+
+// uploadSlotTimeout bounds how long an upload waits for a free slot
+var uploadSlotTimeout = 2 * time.Second
@@ -0,0 +1,98 @@
+package main
+
+import (
+	"fmt"
+	"log"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+)
+
+// logSampler limits how often an identical error is logged: the first limit occurrences
+// in each interval are written and the rest are summarised when the interval ends
+type logSampler struct {
+	mu       sync.Mutex
+	limit    int
+	interval time.Duration
+	counts   map[string]*sampledLog
+}
+
+// sampledLog tracks one distinct error within the current interval
+type sampledLog struct {
+	message string
+	count   int
+}
+
+// errorLogs samples error logs on the upload and list paths; nil logs everything
+var errorLogs *logSampler
+
+// newLogSampler returns a sampler that flushes its summaries every interval
+func newLogSampler(limit int, interval time.Duration) *logSampler {
+	s := &logSampler{limit: limit, interval: interval, counts: map[string]*sampledLog{}}
+	go func() {
+		for range time.Tick(interval) {
+			s.flush()
+		}
+	}()
+	return s
+}
+
+// logErrorf logs an error through errorLogs, so repeats beyond LOG_SAMPLE_RATE per
+// LOG_SAMPLE_INTERVAL are counted instead of written
+func logErrorf(format string, args ...any) {
+	if errorLogs == nil {
+		log.Printf(format, args...)
+		return
+	}
+	errorLogs.logf(format, args...)
+}
+
+// logf writes a log line unless the same error was already logged limit times this interval.
+// Every distinct error is written at least once.
+func (s *logSampler) logf(format string, args ...any) {
+	message := fmt.Sprintf(format, args...)
+	key := sampleKey(format, args)
+
+	s.mu.Lock()
+	entry, ok := s.counts[key]
+	if !ok {
+		entry = &sampledLog{message: message}
+		s.counts[key] = entry
+	}
+	entry.count++
+	write := entry.count <= s.limit
+	s.mu.Unlock()
+
+	if write {
+		log.Print(message)
+	}
+}
+
+// flush logs a summary of the errors suppressed in the interval that just ended
+func (s *logSampler) flush() {
+	s.mu.Lock()
+	counts := s.counts
+	s.counts = map[string]*sampledLog{}
+	s.mu.Unlock()
+
+	for _, entry := range counts {
+		if suppressed := entry.count - s.limit; suppressed > 0 {
+			log.Printf("Suppressed %d more in the last %s like: %s", suppressed, s.interval, entry.message)
+		}
+	}
+}
+
+// sampleKey identifies identical errors. AWS errors are keyed by their code, because
+// their messages carry a per-request ID that would make every throttling error unique.
+func sampleKey(format string, args []any) string {
+	keyArgs := make([]any, len(args))
+	for i, arg := range args {
+		if aerr, ok := arg.(awserr.Error); ok {
+			keyArgs[i] = aerr.Code()
+			continue
+		}
+		keyArgs[i] = arg
+	}
+	return fmt.Sprintf(format, keyArgs...)
+}
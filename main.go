@@ -2,33 +2,139 @@ package main
 
 import (
 	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
 	"log"
-	"mime/multipart"
 	"net/http"
 	"os"
+	"os/signal"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"syscall"
 	"time"
 
 	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/client"
 	"github.com/aws/aws-sdk-go/aws/credentials"
+	"github.com/aws/aws-sdk-go/aws/request"
 	"github.com/aws/aws-sdk-go/aws/session"
 	"github.com/aws/aws-sdk-go/service/s3"
 	"github.com/gin-contrib/cors"
 	"github.com/gin-gonic/gin"
 	"github.com/joho/godotenv"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
 	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
 	"go.mongodb.org/mongo-driver/mongo"
 	"go.mongodb.org/mongo-driver/mongo/options"
+	"golang.org/x/sync/semaphore"
 )
 
 var (
-	s3Session *s3.S3
-	bucket    string
-	mongoURI  string
-	dbName    string
-	collName  string
+	s3Session   *s3.S3
+	mongoClient *mongo.Client
+	storage     Storage
+	bucket      string
+	mongoURI    string
+	dbName      string
+	collName    string
+	tenants     []string
+
+	storageBackend        string
+	localStorageDir       string
+	normalizeOrientation  bool
+	extractGeo            bool
+	convertWebP           bool
+	computeBlurhashes     bool
+	allowedExtensions     []string
+	blockedExtensions     []string
+	allowedMIMETypes      []string
+	generateThumbnails    bool
+	thumbnailSize         int
+	thumbnailWorkers      int
+	reprocessWorkers      int
+	thumbnailQueueSize    int
+	remoteFetchMaxBytes   int64
+	remoteFetchTimeout    time.Duration
+	mongoHealthInterval   time.Duration
+	deepHealth            bool
+	deepHealthInterval    time.Duration
+	uploadFieldName       string
+	svgSanitizeMode       string
+	multipartMemory       int64
+	maxMultipartParts     int
+	maxResults            int
+	fetchSoftDeadline     time.Duration
+	maxUploadBytes        int64
+	maxHeaderBytes        int
+	typeSizeLimits        map[string]int64
+	maxExpiryDays         int
+	documentTTLDays       int
+	lifecycleTag          map[string]string
+	noOverwrite           bool
+	encryptPII            bool
+	spoolOnS3Failure      bool
+	spoolDir              string
+	spoolRetryInterval    time.Duration
+	normalizeEmails       bool
+	normalizeGmail        bool
+	keepRawEmail          bool
+	s3MaxRetries          int
+	s3RetryMaxElapsed     time.Duration
+	conditionalWrites     bool
+	safeUpload            bool
+	dedupEnabled          bool
+	dedupReject           bool
+	s3GrantRead           string
+	storeAuditMeta        bool
+	trustedProxies        []string
+	corsEnabled           bool
+	corsMaxAge            time.Duration
+	corsExposeHeaders     []string
+	presignMaxBytes       int64
+	presignExpiry         time.Duration
+	perUserQuotaBytes     int64
+	quotaCollName         string
+	quotaOverridesEnabled bool
+	quotaCacheTTL         time.Duration
+	countCacheTTL         time.Duration
+	maxRequestTimeout     time.Duration
+	auditCollName         string
+	uploadSessionCollName string
+	publicBaseURL         string
+	maxImagePixels        int64
+	minImageWidth         int
+	minImageHeight        int
 )
 
-func init() {
+// throttleRetryAfter is the Retry-After value, in seconds, sent when S3 throttles an upload
+const throttleRetryAfter = "5"
+
+// multipartOverheadBytes allows for form fields and multipart framing on top of MAX_UPLOAD_BYTES
+const multipartOverheadBytes = 1 << 20
+
+// uploadResponse is returned by postSubmit after a successful upload
+type uploadResponse struct {
+	Message       string `json:"message"`
+	Status        string `json:"status,omitempty"`
+	ID            string `json:"id"`
+	URL           string `json:"url"`
+	ContentType   string `json:"content_type"`
+	Size          int64  `json:"size"`
+	Width         *int   `json:"width"`
+	Height        *int   `json:"height"`
+	PageCount     *int   `json:"page_count,omitempty"`
+	Duplicate     bool   `json:"duplicate,omitempty"`
+	DuplicateOf   string `json:"duplicate_of,omitempty"`
+	CorrelationID string `json:"correlation_id,omitempty"`
+}
+
+// setup loads the configuration and connects to S3 and MongoDB; it runs from main rather
+// than init so tests can load the package without a .env file or live services
+func setup() {
 	// Load environment variables from .env file
 	err := godotenv.Load()
 	if err != nil {
@@ -40,9 +146,205 @@ func init() {
 	mongoURI = os.Getenv("MONGODB_CONN_URI")
 	dbName = os.Getenv("MONGODB_DB_NAME")
 	collName = os.Getenv("COLLECTION_NAME")
+	tenants = parseList(os.Getenv("TENANTS"))
+	for _, tenant := range tenants {
+		if !tenantPattern.MatchString(tenant) {
+			log.Fatalf("Invalid tenant %q in TENANTS: use up to 64 lowercase letters, digits, _ or -", tenant)
+		}
+	}
+	normalizeOrientation = os.Getenv("NORMALIZE_IMAGE_ORIENTATION") == "true"
+	extractGeo = os.Getenv("EXTRACT_GEO") == "true"
+	convertWebP = os.Getenv("CONVERT_TO_WEBP") == "true"
+	allowedExtensions = parseExtensions(os.Getenv("ALLOWED_EXTENSIONS"))
+	blockedExtensions = parseExtensions(os.Getenv("BLOCKED_EXTENSIONS"))
+	allowedMIMETypes = parseList(os.Getenv("ALLOWED_MIME_TYPES"))
+	generateThumbnails = os.Getenv("GENERATE_THUMBNAILS") == "true"
+	computeBlurhashes = os.Getenv("COMPUTE_BLURHASH") == "true"
+	maxImagePixels = int64(envInt("MAX_IMAGE_PIXELS", 50000000))
+	if maxImagePixels < 0 {
+		log.Fatal("MAX_IMAGE_PIXELS must not be negative")
+	}
+	minImageWidth = envInt("MIN_IMAGE_WIDTH", 0)
+	minImageHeight = envInt("MIN_IMAGE_HEIGHT", 0)
+	thumbnailSize = envInt("THUMBNAIL_SIZE", 256)
+	thumbnailWorkers = envInt("THUMBNAIL_WORKERS", 2)
+	if thumbnailWorkers < 1 {
+		log.Fatal("THUMBNAIL_WORKERS must be at least 1")
+	}
+	reprocessWorkers = envInt("REPROCESS_WORKERS", 4)
+	if reprocessWorkers < 1 {
+		log.Fatal("REPROCESS_WORKERS must be at least 1")
+	}
+	thumbnailQueueSize = envInt("THUMBNAIL_QUEUE_SIZE", 100)
+	if thumbnailQueueSize < 0 {
+		log.Fatal("THUMBNAIL_QUEUE_SIZE must not be negative")
+	}
+	remoteFetchMaxBytes = int64(envInt("REMOTE_FETCH_MAX_BYTES", 10<<20))
+	remoteFetchTimeout = envDuration("REMOTE_FETCH_TIMEOUT", 10*time.Second)
+	uploadFieldName = os.Getenv("UPLOAD_FIELD_NAME")
+	if uploadFieldName == "" {
+		uploadFieldName = "picture"
+	}
+	svgSanitizeMode = os.Getenv("SVG_SANITIZE")
+	if svgSanitizeMode == "" {
+		svgSanitizeMode = "reject"
+	}
+	if svgSanitizeMode != "strip" && svgSanitizeMode != "reject" {
+		log.Fatal("SVG_SANITIZE must be either strip or reject")
+	}
+	// Multipart parts beyond this size spill to os.TempDir(), which honours TMPDIR
+	multipartMemory = int64(envInt("MULTIPART_MEMORY_BYTES", 32<<20))
+	log.Printf("Multipart uploads larger than %d bytes are buffered in %s", multipartMemory, os.TempDir())
+	maxMultipartParts = envInt("MAX_MULTIPART_PARTS", 100)
+	maxResults = envInt("MAX_RESULTS", 1000)
+	if maxResults < 0 {
+		log.Fatal("MAX_RESULTS must not be negative")
+	}
+	fetchSoftDeadline = envDuration("FETCH_SOFT_DEADLINE", 0)
+	if fetchSoftDeadline < 0 {
+		log.Fatal("FETCH_SOFT_DEADLINE must not be negative")
+	}
+	if maxUploads := envInt("MAX_CONCURRENT_UPLOADS", 0); maxUploads > 0 {
+		uploadSlots = semaphore.NewWeighted(int64(maxUploads))
+	}
+	// net/http answers 431 itself when request headers outgrow this
+	maxHeaderBytes = envInt("MAX_HEADER_BYTES", 64<<10)
+	if maxHeaderBytes <= 0 {
+		log.Fatal("MAX_HEADER_BYTES must be positive")
+	}
+	maxUploadBytes = int64(envInt("MAX_UPLOAD_BYTES", 0))
+	if maxUploadBytes < 0 {
+		log.Fatal("MAX_UPLOAD_BYTES must not be negative")
+	}
+	if typeSizeLimits, err = parseTypeSizeLimits(os.Getenv("TYPE_SIZE_LIMITS")); err != nil {
+		log.Fatalf("Invalid TYPE_SIZE_LIMITS: %v", err)
+	}
+	uploadSlotTimeout = envDuration("UPLOAD_SLOT_TIMEOUT", uploadSlotTimeout)
+	if rate := envInt("LOG_SAMPLE_RATE", 0); rate > 0 {
+		errorLogs = newLogSampler(rate, envDuration("LOG_SAMPLE_INTERVAL", time.Minute))
+	}
+	adminJWTSecret = []byte(os.Getenv("ADMIN_JWT_SECRET"))
+	hmacSecret = []byte(os.Getenv("HMAC_SECRET"))
+	hmacMaxSkew = envDuration("HMAC_MAX_SKEW", 5*time.Minute)
+	useEnvelope = os.Getenv("API_RESPONSE_ENVELOPE") == "true"
+	noOverwrite = os.Getenv("S3_NO_OVERWRITE") == "true"
+	readOnly.Store(os.Getenv("READ_ONLY") == "true")
+	spoolOnS3Failure = os.Getenv("SPOOL_ON_S3_FAILURE") == "true"
+	spoolDir = os.Getenv("SPOOL_DIR")
+	if spoolDir == "" {
+		spoolDir = filepath.Join(os.TempDir(), "upload-spool")
+	}
+	spoolRetryInterval = envDuration("SPOOL_RETRY_INTERVAL", time.Minute)
+	if spoolRetryInterval <= 0 {
+		log.Fatal("SPOOL_RETRY_INTERVAL must be positive")
+	}
+	if spoolOnS3Failure {
+		if err := os.MkdirAll(spoolDir, 0o700); err != nil {
+			log.Fatalf("Failed to create SPOOL_DIR: %v", err)
+		}
+	}
+	normalizeEmails = os.Getenv("NORMALIZE_EMAILS") == "true"
+	normalizeGmail = os.Getenv("NORMALIZE_GMAIL") == "true"
+	keepRawEmail = os.Getenv("KEEP_RAW_EMAIL") == "true"
+	encryptPII = os.Getenv("ENCRYPT_PII") == "true"
+	if encryptPII {
+		if err := setupFieldEncryption(os.Getenv("FIELD_ENCRYPTION_KEY")); err != nil {
+			log.Fatalf("ENCRYPT_PII is set but the key is unusable: %v", err)
+		}
+	}
+	s3MaxRetries = envInt("S3_MAX_RETRIES", client.DefaultRetryerMaxNumRetries)
+	if s3MaxRetries < 0 {
+		log.Fatal("S3_MAX_RETRIES must not be negative")
+	}
+	s3RetryMaxElapsed = envDuration("S3_RETRY_MAX_ELAPSED", 0)
+	if s3RetryMaxElapsed < 0 {
+		log.Fatal("S3_RETRY_MAX_ELAPSED must not be negative")
+	}
+	conditionalWrites = os.Getenv("S3_CONDITIONAL_WRITES") == "true"
+	safeUpload = os.Getenv("SAFE_UPLOAD") == "true"
+	dedupEnabled = os.Getenv("DEDUP_ENABLED") == "true"
+	dedupReject = os.Getenv("DEDUP_REJECT") == "true"
+	s3GrantRead = os.Getenv("S3_GRANT_READ")
+	if s3GrantRead != "" && !validGrant(s3GrantRead) {
+		log.Fatalf("S3_GRANT_READ must be grantees such as id=<canonical-user-id>, got %q", s3GrantRead)
+	}
+	storeAuditMeta = os.Getenv("STORE_AUDIT_META") == "true"
+	corsEnabled = os.Getenv("CORS_ENABLED") != "false"
+	corsMaxAge = envDuration("CORS_MAX_AGE", 12*time.Hour)
+	corsExposeHeaders = splitList(os.Getenv("CORS_EXPOSE_HEADERS"))
+	if len(corsExposeHeaders) == 0 {
+		corsExposeHeaders = []string{"Content-Length", "X-Request-ID", "X-Correlation-ID", "X-Total-Count", "Link"}
+	}
+	trustedProxies = parseList(os.Getenv("TRUSTED_PROXIES"))
+	if len(trustedProxies) == 0 {
+		trustedProxies = []string{"127.0.0.1", "::1"}
+	}
+	for _, proxy := range trustedProxies {
+		if !validIPOrCIDR(proxy) {
+			log.Fatalf("TRUSTED_PROXIES contains an invalid address or CIDR: %s", proxy)
+		}
+		if proxy == "0.0.0.0/0" || proxy == "::/0" {
+			log.Printf("Warning: TRUSTED_PROXIES trusts every address (%s); client IPs can be spoofed", proxy)
+		}
+	}
+	presignMaxBytes = int64(envInt("PRESIGN_MAX_BYTES", 10<<20))
+	presignExpiry = envDuration("PRESIGN_EXPIRY", 15*time.Minute)
+	perUserQuotaBytes = int64(envInt("PER_USER_QUOTA_BYTES", 0))
+	quotaCollName = os.Getenv("QUOTA_COLLECTION")
+	quotaOverridesEnabled = quotaCollName != ""
+	if quotaCollName == "" {
+		quotaCollName = "quotas"
+	}
+	quotaCacheTTL = envDuration("QUOTA_CACHE_TTL", 30*time.Second)
+	countCacheTTL = envDuration("COUNT_CACHE_TTL", 10*time.Second)
+	maxRequestTimeout = envDuration("MAX_REQUEST_TIMEOUT", 5*time.Minute)
+	publicBaseURL = strings.TrimRight(os.Getenv("PUBLIC_BASE_URL"), "/")
+	uploadSessionCollName = os.Getenv("UPLOAD_SESSION_COLLECTION")
+	if uploadSessionCollName == "" {
+		uploadSessionCollName = "upload_sessions"
+	}
+	auditCollName = os.Getenv("AUDIT_COLLECTION")
+	if auditCollName == "" {
+		auditCollName = "audit"
+	}
+	maxExpiryDays = envInt("MAX_EXPIRY_DAYS", 365)
+	documentTTLDays = envInt("DOCUMENT_TTL_DAYS", 0)
+	if documentTTLDays < 0 {
+		log.Fatal("DOCUMENT_TTL_DAYS must not be negative")
+	}
+	lifecycleTag, err = parseTag(os.Getenv("LIFECYCLE_TAG"), "lifecycle=temp")
+	if err != nil {
+		log.Fatalf("LIFECYCLE_TAG is invalid: %v", err)
+	}
+	keyTemplateText := os.Getenv("S3_KEY_TEMPLATE")
+	if keyTemplateText == "" {
+		keyTemplateText = defaultKeyTemplate
+	}
+	keyTemplate, err = parseKeyTemplate(keyTemplateText)
+	if err != nil {
+		log.Fatalf("S3_KEY_TEMPLATE is invalid: %v", err)
+	}
+	contentAddressedKeys = usesContentHash(keyTemplateText)
+	mongoHealthInterval = envDuration("MONGO_HEALTH_INTERVAL", 10*time.Second)
+	if mongoHealthInterval <= 0 {
+		log.Fatal("MONGO_HEALTH_INTERVAL must be positive")
+	}
+	deepHealth = os.Getenv("DEEP_HEALTH") == "true"
+	deepHealthInterval = envDuration("DEEP_HEALTH_INTERVAL", 30*time.Second)
+	if deepHealthInterval <= 0 {
+		log.Fatal("DEEP_HEALTH_INTERVAL must be positive")
+	}
+
+	storageBackend = os.Getenv("STORAGE_BACKEND")
+	if storageBackend == "" {
+		storageBackend = "s3"
+	}
+	if storageBackend != "s3" && storageBackend != "local" {
+		log.Fatal("STORAGE_BACKEND must be either s3 or local")
+	}
 
 	// Log errors if any of the critical environment variables are missing
-	if bucket == "" {
+	if bucket == "" && storageBackend == "s3" {
 		log.Fatal("AWS_BUCKET is not set in the environment variables")
 	}
 	if mongoURI == "" {
@@ -55,146 +357,940 @@ func init() {
 		log.Fatal("COLLECTION_NAME is not set in the environment variables")
 	}
 
+	// A mistyped region otherwise only surfaces later as an endpoint resolution error
+	region := os.Getenv("AWS_REGION")
+	if region == "" {
+		region = defaultRegion
+	}
+	if !validRegion(region) {
+		log.Fatalf("AWS_REGION %q is not a known AWS region; valid regions are: %s", region, strings.Join(knownRegions(), ", "))
+	}
+
 	// Initialize AWS S3 session
-	awsSession, err := session.NewSession(&aws.Config{
-		Region: aws.String(os.Getenv("AWS_REGION")),
+	// The retryer must see every failure for S3_RETRY_MAX_ELAPSED to apply, hence EnforceShouldRetryCheck
+	awsSession, err := session.NewSession(request.WithRetryer(&aws.Config{
+		Region: aws.String(region),
 		Credentials: credentials.NewStaticCredentials(
 			os.Getenv("AWS_ACCESS_KEY"),
 			os.Getenv("AWS_SECRET_KEY"),
 			"",
 		),
-	})
+		EnforceShouldRetryCheck: aws.Bool(true),
+	}, newS3Retryer(s3MaxRetries, s3RetryMaxElapsed)))
 	if err != nil {
 		log.Fatalf("Failed to initialize AWS session: %v", err)
 	}
 	s3Session = s3.New(awsSession)
 
+	// Dependencies may still be starting in containerized deploys, so retry before giving up
+	startupRetries := envInt("STARTUP_RETRIES", 5)
+	if startupRetries < 0 {
+		log.Fatal("STARTUP_RETRIES must not be negative")
+	}
+	startupRetryDelay := envDuration("STARTUP_RETRY_DELAY", 2*time.Second)
+	if storageBackend == "s3" {
+		if err := waitForDependency("S3 bucket "+bucket, startupRetries, startupRetryDelay, headBucket); err != nil {
+			log.Fatalf("Failed to reach S3 bucket %s: %v", bucket, err)
+		}
+	}
+
+	// Catch the classic "bucket is in a different region" misconfiguration early
+	if storageBackend == "s3" {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+		region, ok, err := checkBucketRegion(ctx, aws.StringValue(awsSession.Config.Region))
+		cancel()
+		if err != nil {
+			log.Printf("Warning: could not determine the region of bucket %s: %v", bucket, err)
+		} else if !ok {
+			log.Fatalf("Bucket %s is in region %s but AWS_REGION is %q", bucket, region, aws.StringValue(awsSession.Config.Region))
+		}
+	}
+
+	// Select the storage backend for uploaded files
+	if storageBackend == "local" {
+		localStorageDir = os.Getenv("LOCAL_STORAGE_DIR")
+		if localStorageDir == "" {
+			localStorageDir = "uploads"
+		}
+		baseURL := os.Getenv("LOCAL_STORAGE_URL")
+		if baseURL == "" {
+			baseURL = "http://localhost:8080/files"
+		}
+		storage = &localStorage{dir: localStorageDir, baseURL: baseURL}
+	} else {
+		storage = newS3Storage()
+	}
+
+	// Initialize the shared MongoDB client
+	// Short selection and socket timeouts make writes fail fast when no primary is reachable
+	clientOptions := options.Client().ApplyURI(mongoURI).
+		SetServerSelectionTimeout(envDuration("MONGO_SERVER_SELECTION_TIMEOUT", 5*time.Second)).
+		SetSocketTimeout(envDuration("MONGO_SOCKET_TIMEOUT", 10*time.Second))
+	tlsConfig, err := mongoTLSConfig()
+	if err != nil {
+		log.Fatalf("Failed to configure MongoDB TLS: %v", err)
+	}
+	if tlsConfig != nil {
+		if tlsConfig.InsecureSkipVerify {
+			log.Println("Warning: MONGO_TLS_INSECURE is set; MongoDB server certificates are not verified")
+		}
+		clientOptions.SetTLSConfig(tlsConfig)
+	}
+	mongoClient, err = mongo.Connect(context.TODO(), clientOptions)
+	if err != nil {
+		log.Fatalf("Failed to initialize MongoDB client: %v", err)
+	}
+	if err := waitForDependency("MongoDB", startupRetries, startupRetryDelay, pingMongo); err != nil {
+		log.Fatalf("Failed to reach MongoDB: %v", err)
+	}
+	// The schema goes first: creating an index would create the collection without it
+	if os.Getenv("MONGO_APPLY_SCHEMA") == "true" {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = forEachPostsCollection(ctx, ensurePostsCollection)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to apply MongoDB collection schema: %v", err)
+		}
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	err = forEachPostsCollection(ctx, ensureSizeIndex)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to create MongoDB size index: %v", err)
+	}
+	ctx, cancel = context.WithTimeout(context.Background(), 30*time.Second)
+	err = forEachPostsCollection(ctx, ensureModifiedIndex)
+	cancel()
+	if err != nil {
+		log.Fatalf("Failed to create MongoDB modified_at index: %v", err)
+	}
+	if dedupEnabled {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = forEachPostsCollection(ctx, ensureContentHashIndex)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to create MongoDB content hash index: %v", err)
+		}
+	}
+	if extractGeo {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = forEachPostsCollection(ctx, ensureLocationIndex)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to create MongoDB location index: %v", err)
+		}
+	}
+	if encryptPII {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = forEachPostsCollection(ctx, ensureEmailHashIndex)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to create MongoDB email hash index: %v", err)
+		}
+	}
+	if documentTTLDays > 0 {
+		ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+		err = forEachPostsCollection(ctx, ensureExpiryIndex)
+		cancel()
+		if err != nil {
+			log.Fatalf("Failed to create MongoDB expiry index: %v", err)
+		}
+	}
+
 	// Log successful AWS and MongoDB connections
 	log.Println("Connected to AWS S3 and MongoDB successfully")
 }
 
-// uploadToS3 uploads a file to AWS S3 and returns the file's URL
-func uploadToS3(file multipart.File, fileName string) (string, error) {
-	buffer := make([]byte, 512)
-	_, err := file.Read(buffer)
-	if err != nil {
-		return "", err
+// postSubmit handles POST requests to save form data
+func postSubmit(c *gin.Context) {
+	// Remove any temporary files the multipart parser spilled to disk, whatever the outcome
+	defer cleanupMultipart(c)
+
+	if ceiling := uploadCeiling(); ceiling > 0 {
+		c.Request.Body = http.MaxBytesReader(c.Writer, c.Request.Body, ceiling+multipartOverheadBytes)
+	}
+	c.Request.Body = limitMultipartParts(c.Request.Body, c.GetHeader("Content-Type"), maxMultipartParts)
+	if err := c.Request.ParseMultipartForm(multipartMemory); err != nil {
+		logErrorf("Error parsing multipart form: %v", err)
+		recordError(c, errorCategoryValidation)
+		var maxBytesErr *http.MaxBytesError
+		if errors.As(err, &maxBytesErr) {
+			respondError(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("Upload exceeds the maximum of %d bytes", uploadCeiling()))
+			return
+		}
+		if errors.Is(err, errTooManyParts) {
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("Upload exceeds the maximum of %d form fields and files", maxMultipartParts))
+			return
+		}
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+		return
+	}
+
+	meta := uploadMeta{
+		Name:  c.PostForm("name"),
+		Email: c.PostForm("email"),
+	}
+	if value := c.PostForm("expires_in_days"); value != "" {
+		days, err := strconv.Atoi(value)
+		if err != nil || days < 1 || days > maxExpiryDays {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, fmt.Sprintf("expires_in_days must be an integer between 1 and %d", maxExpiryDays))
+			return
+		}
+		meta.ExpiresInDays = days
+	}
+
+	if value := c.PostForm("metadata"); value != "" {
+		var parsed interface{}
+		if err := json.Unmarshal([]byte(value), &parsed); err != nil {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "metadata must be valid JSON")
+			return
+		}
+		object, ok := parsed.(map[string]interface{})
+		if !ok {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "metadata must be a JSON object")
+			return
+		}
+		meta.Metadata = object
 	}
-	file.Seek(0, 0) // Reset file pointer to the beginning
 
-	_, err = s3Session.PutObject(&s3.PutObjectInput{
-		Bucket:      aws.String(bucket),
-		Key:         aws.String(fileName),
-		Body:        file,
-		ContentType: aws.String(http.DetectContentType(buffer)),
-		ACL:         aws.String("public-read"),
-	})
+	file, header, err := c.Request.FormFile(uploadFieldName)
 	if err != nil {
-		return "", err
+		logErrorf("Error while uploading file: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+		return
 	}
+	defer file.Close()
+	meta.Filename = header.Filename
 
-	fileURL := "https://" + bucket + ".s3.amazonaws.com/" + fileName
-	return fileURL, nil
+	saveUpload(c, meta, file)
 }
 
-// connectMongo connects to MongoDB and returns a collection handle
-func connectMongo() (*mongo.Collection, error) {
-	client, err := mongo.Connect(context.TODO(), options.Client().ApplyURI(mongoURI))
-	if err != nil {
-		return nil, err
+// cleanupMultipart removes any temporary files the multipart parser spilled to disk
+func cleanupMultipart(c *gin.Context) {
+	if c.Request.MultipartForm != nil {
+		if err := c.Request.MultipartForm.RemoveAll(); err != nil {
+			logErrorf("Error removing multipart temp files: %v", err)
+		}
 	}
-	return client.Database(dbName).Collection(collName), nil
 }
 
-// postSubmit handles POST requests to save form data
-func postSubmit(c *gin.Context) {
-	name := c.PostForm("name")
-	email := c.PostForm("email")
-	file, header, err := c.Request.FormFile("picture")
-	if err != nil {
-		log.Printf("Error while uploading file: %v", err)
-		c.JSON(http.StatusBadRequest, gin.H{"error": "Invalid file upload"})
-		return
+// uploadMeta describes the post submitted alongside an uploaded file
+type uploadMeta struct {
+	Name          string
+	Email         string
+	Filename      string
+	ExpiresInDays int
+	Metadata      map[string]interface{}
+	// Key, when set, stores the file under this existing key, replacing the object there,
+	// instead of building a new one; direct uploads use it to replace what the client sent
+	Key string
+}
+
+// saveUpload validates a file, uploads it to S3 and records it in MongoDB, writing the response.
+// It returns the new post's ID and the key of the object it references, reporting false
+// after responding when no post was created.
+func saveUpload(c *gin.Context, meta uploadMeta, file io.ReadSeeker) (primitive.ObjectID, string, bool) {
+	filename := meta.Filename
+	// expires_in_days overrides the DOCUMENT_TTL_DAYS default
+	if meta.ExpiresInDays == 0 {
+		meta.ExpiresInDays = documentTTLDays
 	}
+	// Quotas are tracked per normalized email; meta.Email stays raw for email_raw
+	ownerEmail := normalizeEmail(meta.Email)
 
-	// Generate a unique file name
-	fileName := time.Now().Format("20060102150405") + "-" + header.Filename
-	fileURL, err := uploadToS3(file, fileName)
+	// Both the extension and the sniffed content type must be allowed; blocked extensions win
+	if extensionBlocked(filename) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "File extension is blocked")
+		return primitive.NilObjectID, "", false
+	}
+	if !extensionAllowed(filename) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "File extension is not allowed")
+		return primitive.NilObjectID, "", false
+	}
+	contentType, err := detectContentType(file)
 	if err != nil {
-		log.Printf("Error uploading file to S3: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to upload image to S3"})
-		return
+		logErrorf("Error reading uploaded file: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+		return primitive.NilObjectID, "", false
+	}
+	isSVG, err := looksLikeSVG(filename, contentType, file)
+	if err != nil {
+		logErrorf("Error reading uploaded file: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+		return primitive.NilObjectID, "", false
+	}
+	if isSVG {
+		contentType = "image/svg+xml"
+	}
+	if !contentTypeAllowed(contentType) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "File type is not allowed")
+		return primitive.NilObjectID, "", false
+	}
+	if isDecodableImage(contentType) {
+		err := checkImagePixels(file)
+		if errors.Is(err, errImageTooLarge) {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnprocessableEntity, codeInvalidFile, fmt.Sprintf("Image exceeds the maximum of %d pixels", maxImagePixels))
+			return primitive.NilObjectID, "", false
+		}
+		if err != nil {
+			logErrorf("Error reading uploaded file: %v", err)
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+			return primitive.NilObjectID, "", false
+		}
 	}
 
-	collection, err := connectMongo()
+	body := file
+	if isSVG {
+		body, err = sanitizeSVG(file, svgSanitizeMode == "strip")
+		if errors.Is(err, errUnsafeSVG) {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnprocessableEntity, codeInvalidFile, "SVG contains scripts or event handlers")
+			return primitive.NilObjectID, "", false
+		}
+		if err != nil {
+			logErrorf("Error parsing SVG file: %v", err)
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnprocessableEntity, codeInvalidFile, "Invalid SVG file")
+			return primitive.NilObjectID, "", false
+		}
+	}
+	// Read the position before normalizing, which drops EXIF, and never store a geotagged original
+	var location *geoPoint
+	if extractGeo && contentType == "image/jpeg" {
+		var found bool
+		location, found, err = extractGPS(body)
+		if err != nil {
+			logErrorf("Error reading uploaded file: %v", err)
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+			return primitive.NilObjectID, "", false
+		}
+		if found && !normalizeOrientation {
+			body, err = normalizeImageOrientation(body)
+			if err != nil {
+				logErrorf("Error stripping EXIF data: %v", err)
+				recordError(c, errorCategoryValidation)
+				respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid image file")
+				return primitive.NilObjectID, "", false
+			}
+		}
+	}
+	if normalizeOrientation {
+		body, err = normalizeImageOrientation(body)
+		if err != nil {
+			logErrorf("Error normalizing image orientation: %v", err)
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid image file")
+			return primitive.NilObjectID, "", false
+		}
+	}
+
+	size, err := body.Seek(0, io.SeekEnd)
+	if err == nil {
+		_, err = body.Seek(0, io.SeekStart)
+	}
+	// The key, stored content type and response all describe the WebP copy; the document keeps the original type
+	var originalContentType string
+	if err == nil && convertWebP {
+		var converted bool
+		if body, size, converted, err = convertToWebP(body, contentType, size); err != nil {
+			logErrorf("Error converting image to WebP: %v", err)
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid image file")
+			return primitive.NilObjectID, "", false
+		}
+		if converted {
+			originalContentType = contentType
+			contentType = "image/webp"
+		}
+	}
+	var contentMD5, contentSHA256 string
+	if err == nil {
+		contentMD5, contentSHA256, err = fileDigests(body)
+	}
+	var width, height *int
+	if err == nil && isDecodableImage(contentType) {
+		var w, h int
+		var ok bool
+		if w, h, ok, err = imageDimensions(body); ok {
+			width, height = &w, &h
+		}
+	}
 	if err != nil {
-		log.Printf("Error connecting to MongoDB: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to MongoDB"})
-		return
+		logErrorf("Error reading uploaded file: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+		return primitive.NilObjectID, "", false
+	}
+	if width != nil && imageTooSmall(*width, *height) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusUnprocessableEntity, codeInvalidFile, fmt.Sprintf("Image must be at least %dx%d pixels, got %dx%d", minImageWidth, minImageHeight, *width, *height))
+		return primitive.NilObjectID, "", false
+	}
+	// Blurhash is a nicety, so an image it cannot decode is still stored without one
+	var placeholder string
+	if computeBlurhashes && width != nil {
+		if placeholder, err = computeBlurhash(body); err != nil {
+			logErrorf("Error computing blurhash: %v", err)
+			placeholder = ""
+		}
+	}
+	var pageCount *int
+	if contentType == "application/pdf" {
+		n, err := pdfPageCount(body, size)
+		if err != nil {
+			logErrorf("Error reading PDF file: %v", err)
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnprocessableEntity, codeInvalidFile, "Invalid PDF file")
+			return primitive.NilObjectID, "", false
+		}
+		pageCount = &n
+	}
+
+	// Per-type limits apply to the sniffed type, even when the image was converted to WebP
+	detectedType := contentType
+	if originalContentType != "" {
+		detectedType = originalContentType
+	}
+	if limit := sizeLimitFor(detectedType); limit > 0 && size > limit {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("Upload exceeds the maximum of %d bytes for %s", limit, mediaType(detectedType)))
+		return primitive.NilObjectID, "", false
+	}
+
+	// Enforce the uploader's quota before anything is written to S3
+	if perUserQuotaBytes > 0 || quotaOverridesEnabled {
+		ok, quota, err := checkQuota(c.Request.Context(), ownerEmail, size)
+		if err != nil {
+			logErrorf("Error checking upload quota in MongoDB: %v", err)
+			recordError(c, errorCategoryMongo)
+			respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to check upload quota")
+			return primitive.NilObjectID, "", false
+		}
+		if !ok {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusRequestEntityTooLarge, codeQuotaExceeded, fmt.Sprintf("Upload would exceed the storage quota of %d bytes for %s", quota, ownerEmail))
+			return primitive.NilObjectID, "", false
+		}
+	}
+
+	// Reuse the stored object of identical content, or reject the upload when DEDUP_REJECT is set
+	var duplicate *postDocument
+	if dedupEnabled {
+		duplicate, err = findDuplicate(c.Request.Context(), contentSHA256)
+		if err != nil {
+			logErrorf("Error checking for duplicate content in MongoDB: %v", err)
+			recordError(c, errorCategoryMongo)
+			respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+			return primitive.NilObjectID, "", false
+		}
+		if duplicate != nil && dedupReject {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusConflict, codeConflict, fmt.Sprintf("Identical content already exists as post %s", duplicate.ID.Hex()))
+			return primitive.NilObjectID, "", false
+		}
 	}
 
+	var fileName, fileURL string
+	var spooled bool
+	if duplicate != nil {
+		fileName, fileURL = objectKeyFor(*duplicate), duplicate.Picture
+	} else {
+		var ok bool
+		keyName := filename
+		if originalContentType != "" {
+			keyName = webpFilename(filename)
+		}
+		if fileName, fileURL, spooled, ok = storeUpload(c, meta, keyName, body, size, contentType, contentSHA256); !ok {
+			return primitive.NilObjectID, "", false
+		}
+	}
+
+	collection := postsCollectionFor(c.Request.Context())
+
 	// Create the document to insert into MongoDB
+	email, err := emailFields(meta.Email)
+	if err != nil {
+		logErrorf("Error encrypting email: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to save data to MongoDB")
+		return primitive.NilObjectID, "", false
+	}
 	document := bson.M{
-		"name":       name,
-		"email":      email,
-		"picture":    fileURL,
-		"created_at": time.Now(),
+		"name":              meta.Name,
+		"picture":           fileURL,
+		"object_key":        fileName,
+		"original_filename": sanitizeFilename(filename),
+		"content_type":      contentType,
+		"size_bytes":        size,
+		"content_md5":       contentMD5,
+		"content_sha256":    contentSHA256,
+		"width":             width,
+		"height":            height,
+		"correlation_id":    c.GetString(correlationIDKey),
+		"created_at":        time.Now(),
+	}
+	for field, value := range email {
+		document[field] = value
+	}
+	if duplicate != nil && duplicate.ThumbnailURL != "" {
+		document["thumbnail_url"] = duplicate.ThumbnailURL
+	}
+	if spooled {
+		document["status"] = statusPendingUpload
+	}
+	if originalContentType != "" {
+		document["original_content_type"] = originalContentType
+	}
+	if placeholder != "" {
+		document["blurhash"] = placeholder
+	}
+	if pageCount != nil {
+		document["page_count"] = *pageCount
+	}
+	if location != nil {
+		document["location"] = location
+	}
+	if meta.Metadata != nil {
+		document["metadata"] = meta.Metadata
+	}
+	if storeAuditMeta {
+		document["uploader_ip"] = c.ClientIP()
+		document["user_agent"] = c.Request.UserAgent()
+	}
+	if meta.ExpiresInDays > 0 {
+		document["expires_at"] = time.Now().AddDate(0, 0, meta.ExpiresInDays)
+	}
+	result, err := collection.InsertOne(context.TODO(), document)
+	if err != nil && spooled {
+		// Without the post the retry worker would never pick the spooled file up
+		removeSpooled(fileName)
+	}
+	if isServerSelectionError(err) {
+		logErrorf("Error saving data to MongoDB, no primary available: %v", err)
+		recordError(c, errorCategoryMongo)
+		c.Header("Retry-After", throttleRetryAfter)
+		respondError(c, http.StatusServiceUnavailable, codeUnavailable, "MongoDB is unavailable, please retry")
+		return primitive.NilObjectID, "", false
 	}
-	_, err = collection.InsertOne(context.TODO(), document)
 	if err != nil {
-		log.Printf("Error saving data to MongoDB: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to save data to MongoDB"})
-		return
+		logErrorf("Error saving data to MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to save data to MongoDB")
+		return primitive.NilObjectID, "", false
+	}
+
+	recordUsage(c.Request.Context(), ownerEmail, size)
+	invalidateCounts()
+
+	id, _ := result.InsertedID.(primitive.ObjectID)
+	log.Printf("Saved post %s (correlation ID %s)", id.Hex(), c.GetString(correlationIDKey))
+	recordAudit(c, auditActionCreate, id.Hex())
+
+	// Thumbnails are best-effort and generated in the background; thumbnail_url is set once ready.
+	// Spooled files get theirs from the retry worker once S3 has them.
+	if generateThumbnails && isDecodableImage(contentType) && duplicate == nil && !spooled {
+		if err := enqueueThumbnail(postsCollectionFor(c.Request.Context()), id, fileName, body); err != nil {
+			logErrorf("Error queueing thumbnail for %s: %v", fileName, err)
+		}
+	}
+
+	status, message, postStatus := http.StatusOK, "Form submitted successfully", ""
+	if spooled {
+		status, message, postStatus = http.StatusAccepted, "Form submitted; the file will be uploaded once S3 recovers", statusPendingUpload
+	}
+	respond(c, status, uploadResponse{
+		Message:       message,
+		Status:        postStatus,
+		ID:            id.Hex(),
+		URL:           publicURL(fileName, fileURL),
+		ContentType:   contentType,
+		Size:          size,
+		Width:         width,
+		Height:        height,
+		PageCount:     pageCount,
+		Duplicate:     duplicate != nil,
+		DuplicateOf:   duplicateOf(duplicate),
+		CorrelationID: c.GetString(correlationIDKey),
+	}, nil)
+	return id, fileName, true
+}
+
+// storeUpload writes a validated upload to storage under a new key, writing the error
+// response itself and reporting false when the upload cannot be stored. With
+// SPOOL_ON_S3_FAILURE a transient S3 failure spools the file instead, reporting spooled.
+func storeUpload(c *gin.Context, meta uploadMeta, filename string, body io.ReadSeeker, size int64, contentType, contentSHA256 string) (fileName, fileURL string, spooled, ok bool) {
+	// Generate a unique file name
+	fileName = meta.Key
+	var err error
+	if fileName == "" {
+		fileName, err = buildKey(c.Request.Context(), filename, contentSHA256)
+	}
+	if err != nil {
+		logErrorf("Error building object key: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file name")
+		return "", "", false, false
 	}
 
-	c.JSON(http.StatusOK, gin.H{"message": "Form submitted successfully"})
+	release, ok := acquireUploadSlot(c.Request.Context())
+	if !ok {
+		c.Header("Retry-After", throttleRetryAfter)
+		respondError(c, http.StatusServiceUnavailable, codeUnavailable, "Too many uploads in progress, please retry later")
+		return "", "", false, false
+	}
+	var finishProgress func(error)
+	original := body
+	if id := uploadSessionID(c); id != "" && uploadIDPattern.MatchString(id) {
+		body, finishProgress = trackUpload(id, body, size)
+	}
+	var putOptions []PutOption
+	if meta.ExpiresInDays > 0 {
+		putOptions = append(putOptions, withTags(lifecycleTag))
+	}
+	if meta.Key != "" {
+		putOptions = append(putOptions, withOverwrite())
+	} else if contentAddressedKeys {
+		putOptions = append(putOptions, withContentAddressed())
+	}
+	fileURL, err = storage.Put(c.Request.Context(), fileName, body, contentType, putOptions...)
+	if finishProgress != nil {
+		finishProgress(err)
+	}
+	if errors.Is(err, ErrObjectExists) {
+		release()
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusConflict, codeConflict, "An object with this key already exists")
+		return "", "", false, false
+	}
+	if isTooLarge(err) {
+		release()
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("Upload exceeds the maximum of %d bytes", uploadCeiling()))
+		return "", "", false, false
+	}
+	// A replaced direct upload is not spooled: the unprocessed original would stay served meanwhile
+	if err != nil && spoolOnS3Failure && storageBackend == "s3" && meta.Key == "" && isTransientS3Error(err) {
+		release()
+		logErrorf("Error uploading file to S3, spooling it for a later retry: %v", err)
+		recordError(c, errorCategoryS3)
+		spoolErr := spoolUpload(fileName, original)
+		if spoolErr == nil {
+			return fileName, s3URLPrefix() + fileName, true, true
+		}
+		log.Printf("Error spooling upload %s: %v", fileName, spoolErr)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to upload image to S3")
+		return "", "", false, false
+	}
+	if err != nil {
+		release()
+		logErrorf("Error uploading file to S3: %v", err)
+		recordError(c, errorCategoryS3)
+		if isThrottleError(err) {
+			c.Header("Retry-After", throttleRetryAfter)
+			respondError(c, http.StatusServiceUnavailable, codeUnavailable, "S3 is throttling uploads, please retry later")
+			return "", "", false, false
+		}
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to upload image to S3")
+		return "", "", false, false
+	}
+
+	uploadedBytes.Observe(float64(size))
+	release()
+	return fileName, fileURL, false, true
 }
 
 // fetchPosts handles GET requests to fetch all posts from MongoDB
 func fetchPosts(c *gin.Context) {
-	collection, err := connectMongo()
+	filter, message, ok := parsePostFilter(c)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, message)
+		return
+	}
+
+	fields, projection, message, ok := parseFields(c)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, message)
+		return
+	}
+	opts := options.Find()
+	if projection != nil {
+		opts.SetProjection(projection)
+	}
+
+	collection := postsCollectionFor(c.Request.Context())
+
+	etag, err := postsETag(c.Request.Context(), collection)
 	if err != nil {
-		log.Printf("Error connecting to MongoDB: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to connect to MongoDB"})
+		logErrorf("Error computing ETag from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	notModified := func() bool {
+		match := c.GetHeader("If-None-Match")
+		return match != "" && etagMatches(match, etag)
+	}
+
+	if c.Query("stream") == "true" {
+		c.Header("ETag", etag)
+		if notModified() {
+			c.Status(http.StatusNotModified)
+			return
+		}
+		streamPosts(c, collection, filter, opts, fields)
 		return
 	}
 
-	cursor, err := collection.Find(context.TODO(), bson.M{})
+	// Fetch one past MAX_RESULTS to find out whether the list was cut short
+	if maxResults > 0 {
+		opts.SetLimit(int64(maxResults) + 1)
+	}
+	results, partial, err := findPostsWithSoftDeadline(c.Request.Context(), collection, filter, opts)
 	if err != nil {
-		log.Printf("Error fetching data from MongoDB: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to fetch data from MongoDB"})
+		logErrorf("Error fetching data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
 		return
 	}
-	defer cursor.Close(context.TODO())
+	// A partial list must not be cached under the ETag of the full one, so it gets neither
+	// the ETag nor a 304, and only complete results are matched against If-None-Match
+	if partial {
+		log.Printf("FETCH_SOFT_DEADLINE of %s reached, returning %d posts", fetchSoftDeadline, len(results))
+		c.Header("X-Partial", "true")
+		c.Header("Cache-Control", "no-store")
+	} else {
+		c.Header("ETag", etag)
+		if notModified() {
+			c.Status(http.StatusNotModified)
+			return
+		}
+	}
+	truncated := maxResults > 0 && len(results) > maxResults
+	if truncated {
+		results = results[:maxResults]
+		c.Header("X-Truncated", "true")
+	}
 
-	var results []bson.M
-	if err = cursor.All(context.TODO(), &results); err != nil {
-		log.Printf("Error parsing data from MongoDB: %v", err)
-		c.JSON(http.StatusInternalServerError, gin.H{"error": "Failed to parse data from MongoDB"})
+	responses, err := projectedPostResponses(results, fields)
+	if err != nil {
+		logErrorf("Error selecting post fields: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to parse data from MongoDB")
 		return
 	}
+	respond(c, http.StatusOK, responses, gin.H{"count": len(results), "truncated": truncated, "partial": partial})
+}
+
+// findPostsWithSoftDeadline runs a find and decodes every match. With FETCH_SOFT_DEADLINE set,
+// hitting that deadline returns the posts decoded so far and reports partial instead of failing.
+func findPostsWithSoftDeadline(ctx context.Context, collection *mongo.Collection, filter bson.M, opts *options.FindOptions) ([]postDocument, bool, error) {
+	findCtx := ctx
+	if fetchSoftDeadline > 0 {
+		var cancel context.CancelFunc
+		findCtx, cancel = context.WithTimeout(ctx, fetchSoftDeadline)
+		defer cancel()
+	}
+	// Only the soft deadline yields a partial result; the request's own deadline still fails
+	softDeadlineHit := func() bool {
+		return fetchSoftDeadline > 0 && ctx.Err() == nil && errors.Is(findCtx.Err(), context.DeadlineExceeded)
+	}
+
+	results := []postDocument{}
+	cursor, err := collection.Find(findCtx, filter, opts)
+	if err != nil {
+		if softDeadlineHit() {
+			return results, true, nil
+		}
+		return nil, false, err
+	}
+	defer cursor.Close(context.WithoutCancel(ctx))
 
-	c.JSON(http.StatusOK, results)
+	for cursor.Next(findCtx) {
+		var doc postDocument
+		if err := cursor.Decode(&doc); err != nil {
+			return nil, false, err
+		}
+		results = append(results, doc)
+	}
+	if err := cursor.Err(); err != nil {
+		if softDeadlineHit() {
+			return results, true, nil
+		}
+		return nil, false, err
+	}
+	return results, false, nil
+}
+
+// fetchPost handles GET requests to fetch a single post by its ID
+func fetchPost(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid post ID")
+		return
+	}
+
+	collection := postsCollectionFor(c.Request.Context())
+
+	// ?track=true counts a view with an atomic $inc and returns the incremented document.
+	// Views are not counted in read-only mode, which only rejects writes by method.
+	var result postDocument
+	if c.Query("track") == "true" && !readOnly.Load() {
+		opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+		err = collection.FindOneAndUpdate(c.Request.Context(), bson.M{"_id": id}, markModified(bson.M{"$inc": bson.M{"views": 1}}), opts).Decode(&result)
+	} else {
+		err = collection.FindOne(c.Request.Context(), bson.M{"_id": id}).Decode(&result)
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching post from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	respond(c, http.StatusOK, toPostResponse(result), nil)
 }
 
 func main() {
+	setup()
+	go monitorMongoHealth(mongoHealthInterval)
+	if deepHealth && storageBackend == "s3" {
+		go monitorS3Writes(deepHealthInterval)
+	}
+
 	r := gin.Default()
 
-	// Enable CORS for specific origins
-	r.Use(cors.New(cors.Config{
-		AllowOrigins:     []string{"http://localhost:3000"},
-		AllowMethods:     []string{"GET", "POST", "PUT", "DELETE", "OPTIONS"},
-		AllowHeaders:     []string{"Origin", "Content-Type", "Authorization"},
-		ExposeHeaders:    []string{"Content-Length"},
-		AllowCredentials: true,
-		MaxAge:           12 * time.Hour,
-	}))
+	// Enable CORS for specific origins, unless an upstream gateway already handles it. It runs
+	// first so preflights are answered and every rejection below still carries CORS headers.
+	if corsEnabled {
+		r.Use(cors.New(cors.Config{
+			AllowOrigins:     []string{"http://localhost:3000"},
+			AllowMethods:     []string{"GET", "POST", "PUT", "PATCH", "DELETE", "OPTIONS"},
+			AllowHeaders:     []string{"Origin", "Content-Type", "Authorization", "X-Request-Timeout", "X-Correlation-ID", "X-Tenant-ID", "X-Upload-ID"},
+			ExposeHeaders:    corsExposeHeaders,
+			AllowCredentials: true,
+			MaxAge:           corsMaxAge,
+		}))
+	}
+	r.Use(requestID())
+	r.Use(correlationID())
+	r.Use(requestTimeout())
+	r.Use(negotiateJSON())
+	r.Use(tenantMiddleware())
+	r.Use(readOnlyMode())
+
+	// Only trust X-Forwarded-For from known proxies so c.ClientIP() cannot be spoofed
+	if err := r.SetTrustedProxies(trustedProxies); err != nil {
+		log.Fatalf("Failed to set trusted proxies: %v", err)
+	}
 
 	// Define routes
+	getAndHead(r, "/healthz", healthz)
+	getAndHead(r, "/readyz", readyz)
+	getAndHead(r, "/metrics", gin.WrapH(promhttp.Handler()))
+	getAndHead(r, "/config", fetchConfig)
+	if storageBackend == "local" {
+		r.Static("/files", localStorageDir)
+	}
 	r.POST("/admin/post-submit", postSubmit)
-	r.GET("/admin/posts", fetchPosts)
+	r.POST("/admin/post-submit-url", requireJSON(), postSubmitURL)
+	r.POST("/admin/post-submit-base64", requireJSON(), postSubmitBase64)
+	getAndHead(r, "/admin/posts", fetchPosts)
+	r.GET("/admin/posts/export", exportPosts)
+	r.GET("/admin/posts/export.zip", exportPostsZip)
+	getAndHead(r, "/admin/posts/latest", fetchLatestPosts)
+	r.GET("/admin/posts/largest", fetchLargestPosts)
+	r.GET("/admin/posts/content-types", fetchContentTypes)
+	getAndHead(r, "/admin/posts/count", fetchPostCount)
+	r.GET("/admin/posts/near", fetchPostsNear)
+	r.GET("/admin/posts/without-thumbnails", fetchPostsWithoutThumbnails)
+	r.GET("/admin/posts/:id", fetchPost)
+	r.PUT("/admin/posts/:id", requireJSON(), replacePost)
+	r.PATCH("/admin/posts/:id", requireJSON(), patchPost)
+	r.DELETE("/admin/posts/:id", deletePost)
+	r.GET("/admin/posts/:id/verify", verifyPost)
+	r.POST("/admin/posts/:id/repair", repairPost)
+	r.POST("/admin/posts/:id/rekey", requireJSON(), rekeyPost)
+	r.POST("/admin/posts/:id/reprocess", reprocessPost)
+	r.GET("/admin/posts/:id/download", downloadPost)
+	r.POST("/admin/maintenance/verify", verifyAllPosts)
+	r.POST("/admin/maintenance/backfill-thumbnails", backfillThumbnails)
+	r.POST("/admin/maintenance/reprocess", reprocessPosts)
+	r.GET("/admin/users/:email/posts", fetchUserPosts)
+	r.GET("/admin/usage", fetchUsage)
+	r.GET("/admin/uploads/:id/progress", streamUploadProgress)
+	r.POST("/admin/uploads/presign", requireJSON(), presignUpload)
+	r.POST("/admin/posts/confirm", requireJSON(), confirmUpload)
+	r.POST("/admin/uploads/session", requireJSON(), createUploadSession)
+	r.POST("/admin/uploads/session/:id/confirm", confirmUploadSession)
+	r.GET("/admin/s3/objects", requireAdmin(), listS3Objects)
+	r.GET("/admin/maintenance/orphans", requireAdmin(), listOrphans)
+	r.GET("/admin/audit", requireAdmin(), fetchAudit)
+	r.POST("/admin/posts/import", requireAdmin(), requireJSON(), importPosts)
+
+	// Server-to-server callers authenticate with HMAC-signed requests instead of JWTs
+	internal := r.Group("/internal", requireSignature())
+	internal.POST("/post-submit-url", requireJSON(), postSubmitURL)
+	internal.POST("/posts/confirm", requireJSON(), confirmUpload)
 
-	// Start the server
-	log.Println("Server is running on http://localhost:8080")
-	r.Run(":8080")
+	if os.Getenv("ENABLE_PPROF") == "true" {
+		registerPprof(r)
+	}
+
+	if generateThumbnails {
+		startThumbnailWorkers(thumbnailWorkers, thumbnailQueueSize)
+	}
+	spoolCtx, stopSpoolRetries := context.WithCancel(context.Background())
+	defer stopSpoolRetries()
+	if spoolOnS3Failure && storageBackend == "s3" {
+		startSpoolRetries(spoolCtx, spoolRetryInterval)
+	}
+	if readOnly.Load() {
+		log.Println("Starting in read-only mode")
+	}
+	go watchReadOnlySignals()
+
+	// Start the server and shut down gracefully on SIGINT or SIGTERM
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt, syscall.SIGTERM)
+	defer stop()
+	srv := &http.Server{Addr: ":8080", Handler: r, MaxHeaderBytes: maxHeaderBytes}
+	go func() {
+		log.Println("Server is running on http://localhost:8080")
+		if err := srv.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+			log.Fatalf("Server failed: %v", err)
+		}
+	}()
+	<-ctx.Done()
+
+	log.Println("Shutting down")
+	shutdownCtx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	if err := srv.Shutdown(shutdownCtx); err != nil {
+		log.Printf("Error shutting down server: %v", err)
+	}
+	// The spool worker queues thumbnails too, so it stops before the queue is closed
+	stopSpoolRetries()
+	spoolRetryDone.Wait()
+	if generateThumbnails {
+		stopThumbnailWorkers()
+	}
 }
@@ -0,0 +1,71 @@
+package main
+
+import (
+	"bytes"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"testing"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+// useMockMongo points the package at a mock deployment for the rest of the test
+func useMockMongo(mt *mtest.T) {
+	previousClient, previousDB, previousColl, previousSessions := mongoClient, dbName, collName, uploadSessionCollName
+	mongoClient, dbName, collName, uploadSessionCollName = mt.Client, "test", "posts", "upload_sessions"
+	mt.Cleanup(func() {
+		mongoClient, dbName, collName, uploadSessionCollName = previousClient, previousDB, previousColl, previousSessions
+	})
+}
+
+func TestPostSubmitRemovesTempFilesOnError(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previousMemory, previousField := multipartMemory, uploadFieldName
+	// Any file part larger than one byte is spilled to a temp file
+	multipartMemory, uploadFieldName = 1, "picture"
+	defer func() { multipartMemory, uploadFieldName = previousMemory, previousField }()
+
+	tests := []struct {
+		name   string
+		fields map[string]string
+	}{
+		{"invalid expiry", map[string]string{"expires_in_days": "soon"}},
+		{"invalid metadata", map[string]string{"metadata": "{"}},
+		{"metadata not an object", map[string]string{"metadata": "[1, 2]"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := t.TempDir()
+			t.Setenv("TMPDIR", dir)
+
+			var body bytes.Buffer
+			form := multipart.NewWriter(&body)
+			for field, value := range tt.fields {
+				form.WriteField(field, value)
+			}
+			part, _ := form.CreateFormFile("picture", "photo.jpg")
+			part.Write(bytes.Repeat([]byte{0xff}, 4096))
+			form.Close()
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/admin/post-submit", &body)
+			c.Request.Header.Set("Content-Type", form.FormDataContentType())
+			postSubmit(c)
+
+			if w.Code != http.StatusBadRequest {
+				t.Fatalf("status = %d, want %d", w.Code, http.StatusBadRequest)
+			}
+			entries, err := os.ReadDir(dir)
+			if err != nil {
+				t.Fatal(err)
+			}
+			for _, entry := range entries {
+				t.Errorf("temp file %s left behind", entry.Name())
+			}
+		})
+	}
+}
@@ -0,0 +1,32 @@
+package main
+
+import (
+	"github.com/gin-gonic/gin"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+)
+
+// Error categories used to label requestErrors
+const (
+	errorCategoryValidation = "validation"
+	errorCategoryS3         = "s3"
+	errorCategoryMongo      = "mongo"
+)
+
+var (
+	requestErrors = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "upload_api_errors_total",
+		Help: "Errors returned by the API, by route and error category.",
+	}, []string{"route", "category"})
+
+	uploadedBytes = promauto.NewSummary(prometheus.SummaryOpts{
+		Name:       "upload_api_uploaded_bytes",
+		Help:       "Size of files successfully uploaded to S3.",
+		Objectives: map[float64]float64{0.5: 0.05, 0.9: 0.01, 0.99: 0.001},
+	})
+)
+
+// recordError counts an error of the given category against the current route
+func recordError(c *gin.Context, category string) {
+	requestErrors.WithLabelValues(c.FullPath(), category).Inc()
+}
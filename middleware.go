@@ -0,0 +1,102 @@
+package main
+
+import (
+	"context"
+	"mime"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// clientDeadlineKey is the context key set when a request runs under an X-Request-Timeout deadline
+const clientDeadlineKey = "client_deadline"
+
+// requireJSON rejects requests whose body is not declared as application/json with 415.
+// It is applied only to JSON routes; multipart upload routes are exempt.
+func requireJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		contentType, _, err := mime.ParseMediaType(c.GetHeader("Content-Type"))
+		if err != nil || contentType != "application/json" {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "Content-Type must be application/json")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
+
+// requestTimeout applies a client-supplied X-Request-Timeout, in milliseconds, as the
+// request context deadline, clamped to maxRequestTimeout. Requests that run past it get 504.
+func requestTimeout() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		value := c.GetHeader("X-Request-Timeout")
+		if value == "" {
+			c.Next()
+			return
+		}
+		ms, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || ms <= 0 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "X-Request-Timeout must be a positive number of milliseconds")
+			c.Abort()
+			return
+		}
+		timeout := min(time.Duration(ms)*time.Millisecond, maxRequestTimeout)
+
+		ctx, cancel := context.WithTimeout(c.Request.Context(), timeout)
+		defer cancel()
+		c.Request = c.Request.WithContext(ctx)
+		c.Set(clientDeadlineKey, true)
+		c.Next()
+
+		if !c.Writer.Written() && ctx.Err() == context.DeadlineExceeded {
+			respondError(c, http.StatusGatewayTimeout, codeTimeout, "Request deadline exceeded")
+		}
+	}
+}
+
+// clientDeadlineExceeded reports whether the request ran past its X-Request-Timeout deadline
+func clientDeadlineExceeded(c *gin.Context) bool {
+	return c.GetBool(clientDeadlineKey) && c.Request.Context().Err() == context.DeadlineExceeded
+}
+
+// getAndHead registers handlers for both GET and HEAD on path. net/http discards the body of
+// HEAD responses, so uptime checkers get the same status and headers as GET without one.
+func getAndHead(r gin.IRoutes, path string, handlers ...gin.HandlerFunc) {
+	r.GET(path, handlers...)
+	r.HEAD(path, handlers...)
+}
+
+// nonJSONRoutes are routes that serve files, archives or other formats and negotiate their
+// own representation, so negotiateJSON leaves them alone
+var nonJSONRoutes = []string{
+	"/metrics",
+	"/files/*filepath",
+	"/admin/posts/export",
+	"/admin/posts/export.zip",
+	"/admin/posts/:id/download",
+	"/admin/uploads/:id/progress",
+}
+
+// negotiateJSON answers 406 when the Accept header rules out JSON. A missing Accept
+// header, */* and application/* all accept JSON.
+func negotiateJSON() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		route := c.FullPath()
+		if containsString(nonJSONRoutes, route) || strings.HasPrefix(route, "/debug/pprof") {
+			c.Next()
+			return
+		}
+		if c.NegotiateFormat(gin.MIMEJSON) == "" {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusNotAcceptable, codeNotAcceptable, "This API only serves application/json")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
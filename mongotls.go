@@ -0,0 +1,36 @@
+package main
+
+import (
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"os"
+)
+
+// mongoTLSConfig builds the MongoDB TLS configuration from MONGO_TLS_CA_FILE and
+// MONGO_TLS_INSECURE. It returns nil when neither is set so the URI settings apply.
+func mongoTLSConfig() (*tls.Config, error) {
+	caFile := os.Getenv("MONGO_TLS_CA_FILE")
+	insecure := os.Getenv("MONGO_TLS_INSECURE") == "true"
+	if caFile == "" && !insecure {
+		return nil, nil
+	}
+
+	config := &tls.Config{
+		MinVersion:         tls.VersionTLS12,
+		InsecureSkipVerify: insecure,
+	}
+	if caFile != "" {
+		pem, err := os.ReadFile(caFile)
+		if err != nil {
+			return nil, fmt.Errorf("reading MONGO_TLS_CA_FILE: %w", err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, errors.New("MONGO_TLS_CA_FILE contains no valid PEM certificates")
+		}
+		config.RootCAs = pool
+	}
+	return config, nil
+}
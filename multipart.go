@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"mime"
+)
+
+// errTooManyParts is returned while parsing a multipart body with more than MAX_MULTIPART_PARTS parts
+var errTooManyParts = errors.New("multipart body has too many parts")
+
+// partLimitReader counts multipart boundary delimiters as the body streams past and fails
+// with errTooManyParts once more than max parts have started, before they are parsed
+type partLimitReader struct {
+	r     io.Reader
+	delim []byte
+	tail  []byte
+	seen  int
+	max   int
+}
+
+func (l *partLimitReader) Read(p []byte) (int, error) {
+	n, err := l.r.Read(p)
+	// Keep the end of the previous read so a delimiter split across reads is still counted
+	buf := append(l.tail, p[:n]...)
+	l.seen += bytes.Count(buf, l.delim)
+	if keep := len(l.delim) - 1; len(buf) > keep {
+		buf = buf[len(buf)-keep:]
+	}
+	l.tail = append(l.tail[:0], buf...)
+
+	// The closing delimiter is counted too, so n parts produce n+1 delimiters. The bytes of
+	// the offending read are dropped so the parser cannot finish the extra parts.
+	if l.seen > l.max+1 {
+		return 0, errTooManyParts
+	}
+	return n, err
+}
+
+// limitMultipartParts wraps a multipart body so parsing stops after max parts. Bodies
+// without a boundary are returned unchanged and left for the multipart parser to reject.
+func limitMultipartParts(body io.ReadCloser, contentType string, max int) io.ReadCloser {
+	if max <= 0 {
+		return body
+	}
+	_, params, err := mime.ParseMediaType(contentType)
+	if err != nil || params["boundary"] == "" {
+		return body
+	}
+	reader := &partLimitReader{r: body, delim: []byte("--" + params["boundary"]), max: max}
+	return struct {
+		io.Reader
+		io.Closer
+	}{reader, body}
+}
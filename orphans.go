@@ -0,0 +1,113 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// referencedKeys returns which of keys are referenced by a post, as its object key,
+// its picture URL (for posts stored before object_key) or its thumbnail URL
+func referencedKeys(c *gin.Context, keys []string) (map[string]bool, error) {
+	urls := make([]string, 0, len(keys))
+	for _, key := range keys {
+		urls = append(urls, s3URLPrefix()+key)
+	}
+	filter := bson.M{"$or": bson.A{
+		bson.M{"object_key": bson.M{"$in": keys}},
+		bson.M{"picture": bson.M{"$in": urls}},
+		bson.M{"thumbnail_url": bson.M{"$in": urls}},
+	}}
+	opts := options.Find().SetProjection(bson.M{"object_key": 1, "picture": 1, "thumbnail_url": 1})
+	cursor, err := postsCollectionFor(c.Request.Context()).Find(c.Request.Context(), filter, opts)
+	if err != nil {
+		return nil, err
+	}
+	var docs []postDocument
+	if err := cursor.All(c.Request.Context(), &docs); err != nil {
+		return nil, err
+	}
+
+	referenced := make(map[string]bool, len(docs))
+	for _, doc := range docs {
+		referenced[objectKeyFor(doc)] = true
+		if doc.ThumbnailURL != "" {
+			referenced[thumbnailKey(objectKeyFor(doc))] = true
+		}
+	}
+	return referenced, nil
+}
+
+// listOrphans handles GET requests that scan one page of S3 objects under a prefix and
+// return those no post references. Resume with ?continuation= to scan the next page, so
+// neither side ever has to fit in memory.
+func listOrphans(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Orphan detection requires the S3 storage backend")
+		return
+	}
+
+	maxKeys := int64(defaultObjectListSize)
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid limit")
+			return
+		}
+		maxKeys = min(limit, maxObjectListSize)
+	}
+
+	// Each tenant scans only its own prefix against its own collection
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(tenantPrefix(c.Request.Context()) + c.Query("prefix")),
+		MaxKeys: aws.Int64(maxKeys),
+	}
+	if token := c.Query("continuation"); token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+	output, err := s3Session.ListObjectsV2WithContext(c.Request.Context(), input)
+	if err != nil {
+		log.Printf("Error listing objects in S3: %v", err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to list objects in S3")
+		return
+	}
+
+	orphans := []s3ObjectInfo{}
+	if len(output.Contents) > 0 {
+		keys := make([]string, 0, len(output.Contents))
+		for _, object := range output.Contents {
+			keys = append(keys, aws.StringValue(object.Key))
+		}
+		referenced, err := referencedKeys(c, keys)
+		if err != nil {
+			log.Printf("Error matching objects against MongoDB: %v", err)
+			recordError(c, errorCategoryMongo)
+			respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+			return
+		}
+		for _, object := range output.Contents {
+			if !referenced[aws.StringValue(object.Key)] && keyInTenant(c.Request.Context(), aws.StringValue(object.Key)) {
+				orphans = append(orphans, s3ObjectInfo{
+					Key:          aws.StringValue(object.Key),
+					Size:         aws.Int64Value(object.Size),
+					LastModified: aws.TimeValue(object.LastModified),
+				})
+			}
+		}
+	}
+
+	respondList(c, http.StatusOK, "orphans", orphans, gin.H{
+		"scanned":           len(output.Contents),
+		"next_continuation": aws.StringValue(output.NextContinuationToken),
+		"truncated":         aws.BoolValue(output.IsTruncated),
+	})
+}
@@ -0,0 +1,66 @@
+package main
+
+import (
+	"context"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultPageSize = 20
+	maxPageSize     = 100
+)
+
+// pagination holds the page and page size requested through ?page= and ?limit=
+type pagination struct {
+	Page  int64
+	Limit int64
+}
+
+// parsePagination reads ?page= and ?limit= from the request, clamping limit to maxPageSize
+func parsePagination(c *gin.Context) (pagination, bool) {
+	p := pagination{Page: 1, Limit: defaultPageSize}
+	if value := c.Query("page"); value != "" {
+		page, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || page < 1 {
+			return p, false
+		}
+		p.Page = page
+	}
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 {
+			return p, false
+		}
+		p.Limit = min(limit, maxPageSize)
+	}
+	return p, true
+}
+
+// findPostsPage returns one page of posts matching filter, newest first, along with the total match count
+func findPostsPage(ctx context.Context, collection *mongo.Collection, filter bson.M, p pagination) ([]postDocument, int64, error) {
+	total, err := cachedCount(ctx, collection, filter)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: -1}}).
+		SetSkip((p.Page - 1) * p.Limit).
+		SetLimit(p.Limit)
+	cursor, err := collection.Find(ctx, filter, opts)
+	if err != nil {
+		return nil, 0, err
+	}
+	defer cursor.Close(context.TODO())
+
+	var results []postDocument
+	if err := cursor.All(ctx, &results); err != nil {
+		return nil, 0, err
+	}
+	return results, total, nil
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+
+	"github.com/ledongthuc/pdf"
+)
+
+// pdfPageCount returns the number of pages in a PDF and rewinds the file afterwards
+func pdfPageCount(file io.ReadSeeker, size int64) (n int, err error) {
+	readerAt, ok := file.(io.ReaderAt)
+	if !ok {
+		if _, err := file.Seek(0, io.SeekStart); err != nil {
+			return 0, err
+		}
+		data, err := io.ReadAll(file)
+		if err != nil {
+			return 0, err
+		}
+		readerAt = bytes.NewReader(data)
+	}
+
+	// The PDF reader panics on some malformed files, so treat a panic as a corrupt PDF
+	defer func() {
+		if r := recover(); r != nil {
+			n, err = 0, fmt.Errorf("malformed PDF: %v", r)
+		}
+	}()
+	reader, err := pdf.NewReader(readerAt, size)
+	if err != nil {
+		return 0, err
+	}
+	n = reader.NumPage()
+	if n <= 0 {
+		return 0, errors.New("PDF has no pages")
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return n, nil
+}
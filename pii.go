@@ -0,0 +1,152 @@
+package main
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"log"
+	"strings"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// encryptedPrefix marks an encrypted field value, so plaintext written before ENCRYPT_PII
+// was turned on is still read back as is
+const encryptedPrefix = "enc:v1:"
+
+var (
+	// fieldCipher encrypts email addresses when ENCRYPT_PII is on
+	fieldCipher cipher.AEAD
+	// emailHashKey keys the deterministic email_hash, derived from FIELD_ENCRYPTION_KEY
+	emailHashKey []byte
+)
+
+// setupFieldEncryption prepares the cipher and hash key from a base64-encoded 32-byte key.
+// Encryption and hashing use separate keys derived from it.
+func setupFieldEncryption(encodedKey string) error {
+	key, err := base64.StdEncoding.DecodeString(encodedKey)
+	if err != nil {
+		return fmt.Errorf("FIELD_ENCRYPTION_KEY must be base64: %w", err)
+	}
+	if len(key) != 32 {
+		return fmt.Errorf("FIELD_ENCRYPTION_KEY must decode to 32 bytes, got %d", len(key))
+	}
+	block, err := aes.NewCipher(hmacSHA256(key, "email_encryption"))
+	if err != nil {
+		return err
+	}
+	if fieldCipher, err = cipher.NewGCM(block); err != nil {
+		return err
+	}
+	emailHashKey = hmacSHA256(key, "email_hash")
+	return nil
+}
+
+// encryptField encrypts a value with AES-GCM under a random nonce
+func encryptField(plaintext string) (string, error) {
+	nonce := make([]byte, fieldCipher.NonceSize())
+	if _, err := rand.Read(nonce); err != nil {
+		return "", err
+	}
+	sealed := fieldCipher.Seal(nonce, nonce, []byte(plaintext), nil)
+	return encryptedPrefix + base64.StdEncoding.EncodeToString(sealed), nil
+}
+
+// decryptField reverses encryptField; values without encryptedPrefix are returned unchanged
+func decryptField(stored string) (string, error) {
+	encoded, ok := strings.CutPrefix(stored, encryptedPrefix)
+	if !ok {
+		return stored, nil
+	}
+	if fieldCipher == nil {
+		return "", errors.New("encrypted value found but ENCRYPT_PII is off")
+	}
+	sealed, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil {
+		return "", err
+	}
+	if len(sealed) < fieldCipher.NonceSize() {
+		return "", errors.New("encrypted value is too short")
+	}
+	nonce, ciphertext := sealed[:fieldCipher.NonceSize()], sealed[fieldCipher.NonceSize():]
+	plaintext, err := fieldCipher.Open(nil, nonce, ciphertext, nil)
+	if err != nil {
+		return "", err
+	}
+	return string(plaintext), nil
+}
+
+// emailHash is the deterministic HMAC of an email used for equality lookups on encrypted emails
+func emailHash(email string) string {
+	return hex.EncodeToString(hmacSHA256(emailHashKey, email))
+}
+
+// emailFields returns the fields storing an email: the normalized email, email_raw when
+// KEEP_RAW_EMAIL is on and normalizing changed it, and with ENCRYPT_PII both encrypted
+// next to the email_hash of the normalized email
+func emailFields(raw string) (bson.M, error) {
+	email := normalizeEmail(raw)
+	fields := bson.M{"email": email}
+	if keepRawEmail && email != raw {
+		fields["email_raw"] = raw
+	}
+	if !encryptPII || email == "" {
+		return fields, nil
+	}
+	for field, value := range fields {
+		encrypted, err := encryptField(value.(string))
+		if err != nil {
+			return nil, err
+		}
+		fields[field] = encrypted
+	}
+	fields["email_hash"] = emailHash(email)
+	return fields, nil
+}
+
+// staleEmailFields returns an $unset document for the optional email fields that an update
+// writing fields, as returned by emailFields, leaves out, so old values do not linger
+func staleEmailFields(fields bson.M) bson.M {
+	unset := bson.M{}
+	for _, field := range []string{"email_raw", "email_hash"} {
+		if _, ok := fields[field]; !ok {
+			unset[field] = ""
+		}
+	}
+	return unset
+}
+
+// emailMatch returns a filter matching posts with exactly this email, once normalized. With
+// ENCRYPT_PII it matches on email_hash, and on the plaintext email for posts stored before
+// encryption.
+func emailMatch(email string) bson.M {
+	email = normalizeEmail(email)
+	if !encryptPII {
+		return bson.M{"email": email}
+	}
+	return bson.M{"$or": bson.A{bson.M{"email_hash": emailHash(email)}, bson.M{"email": email}}}
+}
+
+// readEmail returns the plaintext of a stored email, logging values that cannot be decrypted
+func readEmail(stored string) string {
+	email, err := decryptField(stored)
+	if err != nil {
+		log.Printf("Error decrypting email: %v", err)
+		return ""
+	}
+	return email
+}
+
+// ensureEmailHashIndex creates the email_hash index used by emailMatch
+func ensureEmailHashIndex(ctx context.Context) error {
+	_, err := postsCollectionFor(ctx).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "email_hash", Value: 1}},
+	})
+	return err
+}
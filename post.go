@@ -0,0 +1,114 @@
+package main
+
+import (
+	"strings"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+)
+
+// postDocument mirrors a post as it is stored in MongoDB
+type postDocument struct {
+	ID               primitive.ObjectID `bson:"_id"`
+	Name             string             `bson:"name"`
+	Email            string             `bson:"email"`
+	Picture          string             `bson:"picture"`
+	ObjectKey        string             `bson:"object_key,omitempty"`
+	OriginalFilename string             `bson:"original_filename,omitempty"`
+	ThumbnailURL     string             `bson:"thumbnail_url,omitempty"`
+	ContentType      string             `bson:"content_type,omitempty"`
+	OriginalType     string             `bson:"original_content_type,omitempty"`
+	SizeBytes        int64              `bson:"size_bytes,omitempty"`
+	ContentMD5       string             `bson:"content_md5,omitempty"`
+	ContentSHA256    string             `bson:"content_sha256,omitempty"`
+	Width            *int               `bson:"width"`
+	Height           *int               `bson:"height"`
+	Blurhash         string             `bson:"blurhash,omitempty"`
+	PageCount        *int               `bson:"page_count,omitempty"`
+	Views            int64              `bson:"views,omitempty"`
+	Location         *geoPoint          `bson:"location,omitempty"`
+	CorrelationID    string             `bson:"correlation_id,omitempty"`
+	ExpiresAt        *time.Time         `bson:"expires_at,omitempty"`
+	Status           string             `bson:"status,omitempty"`
+	Metadata         bson.M             `bson:"metadata,omitempty"`
+	CreatedAt        time.Time          `bson:"created_at"`
+	UpdatedAt        *time.Time         `bson:"updated_at,omitempty"`
+}
+
+// PostResponse is the JSON shape returned to API clients for a post
+type PostResponse struct {
+	ID               string     `json:"id"`
+	Name             string     `json:"name"`
+	Email            string     `json:"email"`
+	Picture          string     `json:"picture"`
+	ThumbnailURL     string     `json:"thumbnailUrl,omitempty"`
+	OriginalFilename string     `json:"originalFilename,omitempty"`
+	Width            *int       `json:"width"`
+	Height           *int       `json:"height"`
+	Blurhash         string     `json:"blurhash,omitempty"`
+	Status           string     `json:"status,omitempty"`
+	PageCount        *int       `json:"pageCount,omitempty"`
+	Views            int64      `json:"views"`
+	Location         *geoPoint  `json:"location,omitempty"`
+	Metadata         bson.M     `json:"metadata,omitempty"`
+	CreatedAt        time.Time  `json:"createdAt"`
+	UpdatedAt        *time.Time `json:"updatedAt,omitempty"`
+}
+
+// toPostResponse converts a stored document into its API representation
+func toPostResponse(doc postDocument) PostResponse {
+	return PostResponse{
+		ID:               doc.ID.Hex(),
+		Name:             doc.Name,
+		Email:            readEmail(doc.Email),
+		Picture:          publicURL(objectKeyFor(doc), doc.Picture),
+		ThumbnailURL:     thumbnailURLFor(doc),
+		OriginalFilename: sanitizeFilename(doc.OriginalFilename),
+		Width:            doc.Width,
+		Height:           doc.Height,
+		Blurhash:         doc.Blurhash,
+		Status:           doc.Status,
+		PageCount:        doc.PageCount,
+		Views:            doc.Views,
+		Location:         doc.Location,
+		Metadata:         doc.Metadata,
+		CreatedAt:        doc.CreatedAt,
+		UpdatedAt:        doc.UpdatedAt,
+	}
+}
+
+// thumbnailURLFor returns the client-facing URL of a post's thumbnail, or "" before one exists
+func thumbnailURLFor(doc postDocument) string {
+	if doc.ThumbnailURL == "" {
+		return ""
+	}
+	return publicURL(thumbnailKey(objectKeyFor(doc)), doc.ThumbnailURL)
+}
+
+// toPostResponses converts a slice of stored documents into API representations
+func toPostResponses(docs []postDocument) []PostResponse {
+	responses := make([]PostResponse, 0, len(docs))
+	for _, doc := range docs {
+		responses = append(responses, toPostResponse(doc))
+	}
+	return responses
+}
+
+// objectKeyFor returns the S3 key of a post's file, deriving it from the
+// picture URL for documents stored before object_key was recorded
+func objectKeyFor(doc postDocument) string {
+	if doc.ObjectKey != "" {
+		return doc.ObjectKey
+	}
+	return strings.TrimPrefix(doc.Picture, s3URLPrefix())
+}
+
+// publicURL returns the client-facing URL of an object: PUBLIC_BASE_URL joined with the
+// key when it is set, otherwise the stored storage URL
+func publicURL(key, storedURL string) string {
+	if publicBaseURL == "" || key == "" {
+		return storedURL
+	}
+	return publicBaseURL + "/" + key
+}
@@ -0,0 +1,21 @@
+package main
+
+import (
+	"net/http/pprof"
+
+	"github.com/gin-gonic/gin"
+)
+
+// registerPprof mounts the net/http/pprof handlers under /debug/pprof behind admin auth
+func registerPprof(r *gin.Engine) {
+	debug := r.Group("/debug/pprof", requireAdmin())
+	debug.GET("/", gin.WrapF(pprof.Index))
+	debug.GET("/cmdline", gin.WrapF(pprof.Cmdline))
+	debug.GET("/profile", gin.WrapF(pprof.Profile))
+	debug.POST("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/symbol", gin.WrapF(pprof.Symbol))
+	debug.GET("/trace", gin.WrapF(pprof.Trace))
+	for _, name := range []string{"allocs", "block", "goroutine", "heap", "mutex", "threadcreate"} {
+		debug.GET("/"+name, gin.WrapH(pprof.Handler(name)))
+	}
+}
@@ -0,0 +1,198 @@
+package main
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+// presignRequest is the body of POST /admin/uploads/presign
+type presignRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type" binding:"required"`
+}
+
+// confirmUploadRequest is the body of POST /admin/posts/confirm
+type confirmUploadRequest struct {
+	Name  string `json:"name"`
+	Email string `json:"email"`
+	Key   string `json:"key" binding:"required"`
+}
+
+// presignedPost is a browser-ready S3 POST form: the fields must be sent before the file
+type presignedPost struct {
+	URL       string            `json:"url"`
+	Key       string            `json:"key"`
+	Fields    map[string]string `json:"fields"`
+	ExpiresAt time.Time         `json:"expires_at"`
+	MaxBytes  int64             `json:"max_bytes"`
+}
+
+// presignUpload handles POST requests for a presigned POST policy so browsers can upload directly to S3
+func presignUpload(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Direct uploads require the S3 storage backend")
+		return
+	}
+
+	var req presignRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
+		return
+	}
+	if extensionBlocked(req.Filename) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "File extension is blocked")
+		return
+	}
+	if !extensionAllowed(req.Filename) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "File extension is not allowed")
+		return
+	}
+	if !contentTypeAllowed(req.ContentType) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "File type is not allowed")
+		return
+	}
+
+	key, err := buildKey(c.Request.Context(), req.Filename, "")
+	if err != nil {
+		log.Printf("Error building object key: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file name")
+		return
+	}
+
+	post, err := newPresignedPost(key, mediaType(req.ContentType), presignMaxBytes, presignExpiry)
+	if err != nil {
+		log.Printf("Error presigning S3 upload: %v", err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to presign S3 upload")
+		return
+	}
+
+	// Only keys recorded here can be confirmed, so clients cannot claim arbitrary objects
+	_, err = uploadSessionsCollection().InsertOne(c.Request.Context(), uploadSession{
+		Kind:        uploadKindPresign,
+		Key:         key,
+		Filename:    req.Filename,
+		ContentType: mediaType(req.ContentType),
+		MaxBytes:    presignMaxBytes,
+		Status:      sessionStatusPending,
+		ExpiresAt:   post.ExpiresAt,
+		CreatedAt:   time.Now(),
+	})
+	if err != nil {
+		log.Printf("Error saving upload session to MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to save data to MongoDB")
+		return
+	}
+	respond(c, http.StatusOK, post, nil)
+}
+
+// newPresignedPost builds a SigV4-signed POST policy for a single key, content type and size limit
+func newPresignedPost(key, contentType string, maxBytes int64, expiry time.Duration) (*presignedPost, error) {
+	creds, err := s3Session.Config.Credentials.Get()
+	if err != nil {
+		return nil, err
+	}
+	region := aws.StringValue(s3Session.Config.Region)
+	now := time.Now().UTC()
+	date := now.Format("20060102")
+	credential := fmt.Sprintf("%s/%s/%s/s3/aws4_request", creds.AccessKeyID, date, region)
+
+	fields := map[string]string{
+		"key":              key,
+		"Content-Type":     contentType,
+		"x-amz-algorithm":  "AWS4-HMAC-SHA256",
+		"x-amz-credential": credential,
+		"x-amz-date":       now.Format("20060102T150405Z"),
+	}
+	if s3GrantRead != "" {
+		fields["x-amz-grant-read"] = s3GrantRead
+	} else {
+		fields["acl"] = "public-read"
+	}
+	if creds.SessionToken != "" {
+		fields["x-amz-security-token"] = creds.SessionToken
+	}
+
+	conditions := []interface{}{
+		map[string]string{"bucket": bucket},
+		[]interface{}{"content-length-range", 1, maxBytes},
+	}
+	for name, value := range fields {
+		conditions = append(conditions, map[string]string{name: value})
+	}
+	expiresAt := now.Add(expiry)
+	policy, err := json.Marshal(map[string]interface{}{
+		"expiration": expiresAt.Format("2006-01-02T15:04:05.000Z"),
+		"conditions": conditions,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	encodedPolicy := base64.StdEncoding.EncodeToString(policy)
+	signingKey := hmacSHA256([]byte("AWS4"+creds.SecretAccessKey), date)
+	signingKey = hmacSHA256(signingKey, region)
+	signingKey = hmacSHA256(signingKey, "s3")
+	signingKey = hmacSHA256(signingKey, "aws4_request")
+	fields["policy"] = encodedPolicy
+	fields["x-amz-signature"] = hex.EncodeToString(hmacSHA256(signingKey, encodedPolicy))
+
+	return &presignedPost{
+		URL:       fmt.Sprintf("https://%s.s3.%s.amazonaws.com/", bucket, region),
+		Key:       key,
+		Fields:    fields,
+		ExpiresAt: expiresAt,
+		MaxBytes:  maxBytes,
+	}, nil
+}
+
+// hmacSHA256 returns HMAC-SHA256(key, data)
+func hmacSHA256(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// confirmUpload handles POST requests recording a post for a file the client uploaded directly
+// to S3 with a presigned POST. The file is checked and processed like a multipart upload.
+func confirmUpload(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Direct uploads require the S3 storage backend")
+		return
+	}
+
+	var req confirmUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !keyInTenant(c.Request.Context(), req.Key) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Email != "" && !validEmail(req.Email) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid email address")
+		return
+	}
+
+	session, ok := claimUploadSession(c, bson.M{"key": req.Key, "kind": uploadKindPresign})
+	if !ok {
+		return
+	}
+	confirmDirectUpload(c, session, uploadMeta{Name: req.Name, Email: req.Email})
+}
@@ -0,0 +1,128 @@
+package main
+
+import (
+	"io"
+	"net/http"
+	"regexp"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	// progressInterval is how often progress events are pushed to subscribers
+	progressInterval = 250 * time.Millisecond
+	// progressWaitTimeout bounds how long a subscriber waits for an upload to start
+	progressWaitTimeout = 30 * time.Second
+	// progressRetention keeps finished uploads around for late subscribers
+	progressRetention = time.Minute
+)
+
+// uploadIDPattern restricts client-chosen upload session ids
+var uploadIDPattern = regexp.MustCompile(`^[A-Za-z0-9_-]{1,64}$`)
+
+// uploadProgress tracks the bytes of one upload sent to storage so far
+type uploadProgress struct {
+	sent  atomic.Int64
+	total int64
+	done  atomic.Bool
+	err   atomic.Value
+}
+
+// inFlightUploads maps upload session ids to their *uploadProgress
+var inFlightUploads sync.Map
+
+// progressReader counts bytes read from the wrapped file into an uploadProgress
+type progressReader struct {
+	file     io.ReadSeeker
+	progress *uploadProgress
+}
+
+func (r *progressReader) Read(p []byte) (int, error) {
+	n, err := r.file.Read(p)
+	r.progress.sent.Add(int64(n))
+	return n, err
+}
+
+// Seek keeps the counter in step when the uploader rewinds the body, e.g. for signing or retries
+func (r *progressReader) Seek(offset int64, whence int) (int64, error) {
+	pos, err := r.file.Seek(offset, whence)
+	if err == nil {
+		r.progress.sent.Store(pos)
+	}
+	return pos, err
+}
+
+// uploadSessionID returns the progress session id supplied with an upload, if any
+func uploadSessionID(c *gin.Context) string {
+	if id := c.GetHeader("X-Upload-ID"); id != "" {
+		return id
+	}
+	if id := c.Query("upload_id"); id != "" {
+		return id
+	}
+	return c.PostForm("upload_id")
+}
+
+// trackUpload registers an upload under id and wraps file so reads are counted.
+// The returned finish function records the outcome and schedules the entry for removal.
+func trackUpload(id string, file io.ReadSeeker, total int64) (io.ReadSeeker, func(error)) {
+	progress := &uploadProgress{total: total}
+	inFlightUploads.Store(id, progress)
+
+	finish := func(err error) {
+		if err != nil {
+			progress.err.Store(err.Error())
+		}
+		progress.done.Store(true)
+		time.AfterFunc(progressRetention, func() { inFlightUploads.CompareAndDelete(id, progress) })
+	}
+	return &progressReader{file: file, progress: progress}, finish
+}
+
+// streamUploadProgress handles GET requests that stream an upload's progress as Server-Sent Events
+func streamUploadProgress(c *gin.Context) {
+	id := c.Param("id")
+	if !uploadIDPattern.MatchString(id) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid upload ID")
+		return
+	}
+
+	ticker := time.NewTicker(progressInterval)
+	defer ticker.Stop()
+	deadline := time.Now().Add(progressWaitTimeout)
+
+	c.Stream(func(w io.Writer) bool {
+		select {
+		case <-c.Request.Context().Done():
+			return false
+		case <-ticker.C:
+		}
+
+		value, ok := inFlightUploads.Load(id)
+		if !ok {
+			if time.Now().After(deadline) {
+				c.SSEvent("error", gin.H{"error": "Upload not found", "code": codeNotFound})
+				return false
+			}
+			return true
+		}
+
+		progress := value.(*uploadProgress)
+		event := gin.H{"bytes_sent": progress.sent.Load(), "total": progress.total}
+		if !progress.done.Load() {
+			c.SSEvent("progress", event)
+			return true
+		}
+		if message, ok := progress.err.Load().(string); ok {
+			event["error"] = message
+			c.SSEvent("error", event)
+			return false
+		}
+		c.SSEvent("complete", event)
+		return false
+	})
+}
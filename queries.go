@@ -0,0 +1,143 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	defaultLatestPosts  = 10
+	maxLatestPosts      = 50
+	defaultLargestPosts = 20
+	maxLargestPosts     = 100
+)
+
+// largestUpload is one entry of GET /admin/posts/largest
+type largestUpload struct {
+	ID        string    `json:"id"`
+	Key       string    `json:"key"`
+	SizeBytes int64     `json:"size_bytes"`
+	Name      string    `json:"name"`
+	Email     string    `json:"email"`
+	CreatedAt time.Time `json:"created_at"`
+}
+
+// fetchLatestPosts handles GET requests for the most recent ?n= posts, newest first
+func fetchLatestPosts(c *gin.Context) {
+	opts, ok := latestPostsOptions(c.Query("n"))
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "n must be a positive integer")
+		return
+	}
+
+	cursor, err := postsCollectionFor(c.Request.Context()).Find(c.Request.Context(), bson.M{}, opts)
+	if err != nil {
+		log.Printf("Error fetching data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var results []postDocument
+	if err := cursor.All(c.Request.Context(), &results); err != nil {
+		log.Printf("Error parsing data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to parse data from MongoDB")
+		return
+	}
+
+	respond(c, http.StatusOK, toPostResponses(results), gin.H{"count": len(results)})
+}
+
+// latestPostsOptions builds the find options for the newest ?n= posts, capped at maxLatestPosts.
+// It reports false when n is not a positive integer.
+func latestPostsOptions(value string) (*options.FindOptions, bool) {
+	n := int64(defaultLatestPosts)
+	if value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			return nil, false
+		}
+		n = min(parsed, maxLatestPosts)
+	}
+	return options.Find().SetSort(bson.D{{Key: "created_at", Value: -1}}).SetLimit(n), true
+}
+
+// fetchLargestPosts handles GET requests for the ?n= largest uploads by size_bytes, biggest
+// first, with their object keys and owners; ?page= walks further down the list
+func fetchLargestPosts(c *gin.Context) {
+	n := int64(defaultLargestPosts)
+	if value := c.Query("n"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "n must be a positive integer")
+			return
+		}
+		n = min(parsed, maxLargestPosts)
+	}
+	page := int64(1)
+	if value := c.Query("page"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "page must be a positive integer")
+			return
+		}
+		page = parsed
+	}
+
+	// _id breaks ties so pages do not overlap when sizes are equal
+	opts := options.Find().
+		SetSort(bson.D{{Key: "size_bytes", Value: -1}, {Key: "_id", Value: 1}}).
+		SetSkip((page - 1) * n).
+		SetLimit(n)
+	filter := bson.M{"size_bytes": bson.M{"$exists": true}}
+	cursor, err := postsCollectionFor(c.Request.Context()).Find(c.Request.Context(), filter, opts)
+	if err != nil {
+		log.Printf("Error fetching data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var results []postDocument
+	if err := cursor.All(c.Request.Context(), &results); err != nil {
+		log.Printf("Error parsing data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to parse data from MongoDB")
+		return
+	}
+
+	uploads := make([]largestUpload, len(results))
+	for i, doc := range results {
+		uploads[i] = largestUpload{
+			ID:        doc.ID.Hex(),
+			Key:       objectKeyFor(doc),
+			SizeBytes: doc.SizeBytes,
+			Name:      doc.Name,
+			Email:     readEmail(doc.Email),
+			CreatedAt: doc.CreatedAt,
+		}
+	}
+	respond(c, http.StatusOK, uploads, gin.H{"count": len(uploads), "page": page, "n": n})
+}
+
+// ensureSizeIndex creates the size_bytes index that keeps fetchLargestPosts from scanning the collection
+func ensureSizeIndex(ctx context.Context) error {
+	_, err := postsCollectionFor(ctx).Indexes().CreateOne(ctx, mongo.IndexModel{
+		Keys: bson.D{{Key: "size_bytes", Value: -1}},
+	})
+	return err
+}
@@ -0,0 +1,120 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestLatestPostsOptions(t *testing.T) {
+	tests := []struct {
+		name      string
+		n         string
+		wantLimit int64
+		wantOK    bool
+	}{
+		{"default", "", defaultLatestPosts, true},
+		{"requested count", "3", 3, true},
+		{"one", "1", 1, true},
+		{"capped", "1000", maxLatestPosts, true},
+		{"zero", "0", 0, false},
+		{"negative", "-2", 0, false},
+		{"not a number", "ten", 0, false},
+	}
+	newestFirst := bson.D{{Key: "created_at", Value: -1}}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			opts, ok := latestPostsOptions(tt.n)
+			if ok != tt.wantOK {
+				t.Fatalf("latestPostsOptions(%q) ok = %v, want %v", tt.n, ok, tt.wantOK)
+			}
+			if !ok {
+				return
+			}
+			if opts.Limit == nil || *opts.Limit != tt.wantLimit {
+				t.Errorf("limit = %v, want %d", opts.Limit, tt.wantLimit)
+			}
+			if !reflect.DeepEqual(opts.Sort, newestFirst) {
+				t.Errorf("sort = %v, want %v", opts.Sort, newestFirst)
+			}
+		})
+	}
+}
+
+func TestFetchLatestPosts(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	tests := []struct {
+		name      string
+		query     string
+		wantLimit int
+	}{
+		{"default", "", defaultLatestPosts},
+		{"requested count", "?n=3", 3},
+		{"capped", "?n=1000", maxLatestPosts},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			useMockMongo(mt)
+			// MongoDB applies the sort and limit, returning the newest posts first
+			now := time.Now()
+			var posts []bson.D
+			var wantIDs []string
+			for i := 0; i < tt.wantLimit; i++ {
+				id := primitive.NewObjectID()
+				posts = append(posts, bson.D{
+					{Key: "_id", Value: id},
+					{Key: "name", Value: "post"},
+					{Key: "picture", Value: "https://example.com/" + id.Hex()},
+					{Key: "created_at", Value: now.Add(-time.Duration(i) * time.Minute)},
+				})
+				wantIDs = append(wantIDs, id.Hex())
+			}
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.posts", mtest.FirstBatch, posts...))
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/admin/posts/latest"+tt.query, nil)
+			fetchLatestPosts(c)
+
+			if w.Code != http.StatusOK {
+				mt.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			event := mt.GetStartedEvent()
+			if event == nil || event.CommandName != "find" {
+				mt.Fatalf("no find was sent")
+			}
+			if limit, ok := event.Command.Lookup("limit").AsInt64OK(); !ok || limit != int64(tt.wantLimit) {
+				mt.Errorf("find limit = %v, want %d", event.Command.Lookup("limit"), tt.wantLimit)
+			}
+			sort := event.Command.Lookup("sort").Document()
+			if value, ok := sort.Lookup("created_at").AsInt64OK(); !ok || value != -1 {
+				mt.Errorf("find sort = %v, want created_at descending", sort)
+			}
+
+			var got []PostResponse
+			if err := json.Unmarshal(w.Body.Bytes(), &got); err != nil {
+				mt.Fatal(err)
+			}
+			if len(got) != len(wantIDs) {
+				mt.Fatalf("got %d posts, want %d", len(got), len(wantIDs))
+			}
+			for i, post := range got {
+				if post.ID != wantIDs[i] {
+					mt.Errorf("post %d = %s, want %s", i, post.ID, wantIDs[i])
+				}
+				if i > 0 && post.CreatedAt.After(got[i-1].CreatedAt) {
+					mt.Errorf("post %d is newer than post %d", i, i-1)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,107 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"sync"
+	"time"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// quotaOverride is a document in the quota collection overriding PER_USER_QUOTA_BYTES for one email
+type quotaOverride struct {
+	Email      string `bson:"email"`
+	QuotaBytes int64  `bson:"quota_bytes"`
+}
+
+// cachedUsage is a user's stored byte count as of fetchedAt
+type cachedUsage struct {
+	bytes     int64
+	fetchedAt time.Time
+}
+
+// usageCache briefly caches per-email usage so every upload does not re-aggregate. Entries
+// are keyed by posts collection and email, so each tenant's usage is counted separately.
+var usageCache = struct {
+	sync.Mutex
+	entries map[string]cachedUsage
+}{entries: map[string]cachedUsage{}}
+
+// userQuota returns the quota for an email, preferring an override from the quota collection.
+// A quota of zero or less means unlimited.
+func userQuota(ctx context.Context, email string) (int64, error) {
+	var override quotaOverride
+	err := mongoClient.Database(dbName).Collection(quotaCollName).FindOne(ctx, bson.M{"email": email}).Decode(&override)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		return perUserQuotaBytes, nil
+	}
+	if err != nil {
+		return 0, err
+	}
+	return override.QuotaBytes, nil
+}
+
+// userUsageBytes returns the total size_bytes stored for an email, cached for quotaCacheTTL
+func userUsageBytes(ctx context.Context, email string) (int64, error) {
+	key := usageKey(ctx, email)
+	usageCache.Lock()
+	entry, ok := usageCache.entries[key]
+	usageCache.Unlock()
+	if ok && time.Since(entry.fetchedAt) < quotaCacheTTL {
+		return entry.bytes, nil
+	}
+
+	pipeline := bson.A{
+		bson.M{"$match": emailMatch(email)},
+		bson.M{"$group": bson.M{"_id": nil, "total_bytes": bson.M{"$sum": "$size_bytes"}}},
+	}
+	cursor, err := postsCollectionFor(ctx).Aggregate(ctx, pipeline)
+	if err != nil {
+		return 0, err
+	}
+	var results []usageTotals
+	if err := cursor.All(ctx, &results); err != nil {
+		return 0, err
+	}
+
+	var total int64
+	if len(results) > 0 {
+		total = results[0].TotalBytes
+	}
+	usageCache.Lock()
+	usageCache.entries[key] = cachedUsage{bytes: total, fetchedAt: time.Now()}
+	usageCache.Unlock()
+	return total, nil
+}
+
+// recordUsage adds a new upload to the cached usage so quick successive uploads are still counted
+func recordUsage(ctx context.Context, email string, size int64) {
+	key := usageKey(ctx, email)
+	usageCache.Lock()
+	defer usageCache.Unlock()
+	if entry, ok := usageCache.entries[key]; ok {
+		entry.bytes += size
+		usageCache.entries[key] = entry
+	}
+}
+
+// usageKey returns the usageCache key for an email in the request's posts collection
+func usageKey(ctx context.Context, email string) string {
+	return postsCollectionFor(ctx).Name() + ":" + email
+}
+
+// checkQuota reports whether storing size more bytes for email stays within its quota,
+// returning the applicable quota
+func checkQuota(ctx context.Context, email string, size int64) (bool, int64, error) {
+	quota, err := userQuota(ctx, email)
+	if err != nil || quota <= 0 {
+		return true, quota, err
+	}
+	used, err := userUsageBytes(ctx, email)
+	if err != nil {
+		return false, quota, err
+	}
+	return used+size <= quota, quota, nil
+}
@@ -0,0 +1,49 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+)
+
+// readOnly is set from READ_ONLY at startup and toggled at runtime by SIGUSR1 and SIGUSR2
+var readOnly atomic.Bool
+
+// readOnlyMode rejects requests that could write, anything but GET, HEAD and OPTIONS,
+// with 503 while the service is in read-only mode
+func readOnlyMode() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		switch c.Request.Method {
+		case http.MethodGet, http.MethodHead, http.MethodOptions:
+		default:
+			if readOnly.Load() {
+				respondError(c, http.StatusServiceUnavailable, codeUnavailable, "Service is in read-only mode, writes are disabled")
+				c.Abort()
+				return
+			}
+		}
+		c.Next()
+	}
+}
+
+// watchReadOnlySignals enters read-only mode on SIGUSR1 and leaves it on SIGUSR2, so
+// maintenance windows do not need a restart
+func watchReadOnlySignals() {
+	signals := make(chan os.Signal, 1)
+	signal.Notify(signals, syscall.SIGUSR1, syscall.SIGUSR2)
+	for sig := range signals {
+		enabled := sig == syscall.SIGUSR1
+		if previous := readOnly.Swap(enabled); previous != enabled {
+			if enabled {
+				log.Println("Entering read-only mode")
+			} else {
+				log.Println("Leaving read-only mode")
+			}
+		}
+	}
+}
@@ -0,0 +1,62 @@
+package main
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestFetchPostTracksViewsOnlyWhenWritable(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previous := readOnly.Load()
+	defer readOnly.Store(previous)
+
+	id := primitive.NewObjectID()
+	post := bson.D{
+		{Key: "_id", Value: id},
+		{Key: "name", Value: "Ada"},
+		{Key: "picture", Value: "https://example.com/photo.jpg"},
+		{Key: "created_at", Value: time.Now()},
+	}
+	tests := []struct {
+		name        string
+		readOnly    bool
+		query       string
+		wantCommand string
+	}{
+		{"tracked view", false, "?track=true", "findAndModify"},
+		{"tracked view in read-only mode", true, "?track=true", "find"},
+		{"untracked view", false, "", "find"},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			useMockMongo(mt)
+			readOnly.Store(tt.readOnly)
+			if tt.wantCommand == "findAndModify" {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: post}))
+			} else {
+				mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.posts", mtest.FirstBatch, post))
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodGet, "/admin/posts/"+id.Hex()+tt.query, nil)
+			c.Params = gin.Params{{Key: "id", Value: id.Hex()}}
+			fetchPost(c)
+
+			if w.Code != http.StatusOK {
+				mt.Fatalf("status = %d, want %d: %s", w.Code, http.StatusOK, w.Body.String())
+			}
+			if event := mt.GetStartedEvent(); event == nil || event.CommandName != tt.wantCommand {
+				mt.Errorf("command = %v, want %s", event, tt.wantCommand)
+			}
+		})
+	}
+}
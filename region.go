@@ -0,0 +1,27 @@
+package main
+
+import (
+	"sort"
+
+	"github.com/aws/aws-sdk-go/aws/endpoints"
+)
+
+// defaultRegion is used when AWS_REGION is unset
+const defaultRegion = endpoints.UsEast1RegionID
+
+// knownRegions returns the sorted IDs of every region in the SDK's partitions
+func knownRegions() []string {
+	var regions []string
+	for _, partition := range endpoints.DefaultPartitions() {
+		for id := range partition.Regions() {
+			regions = append(regions, id)
+		}
+	}
+	sort.Strings(regions)
+	return regions
+}
+
+// validRegion reports whether region is a known AWS region
+func validRegion(region string) bool {
+	return containsString(knownRegions(), region)
+}
@@ -0,0 +1,199 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// rekeyRollbackTimeout bounds removing the copies of a failed rekey, which runs on its own
+// context so a cancelled request still cleans up
+const rekeyRollbackTimeout = 30 * time.Second
+
+// rekeyRequest is the body of POST /admin/posts/:id/rekey
+type rekeyRequest struct {
+	Key string `json:"key" binding:"required"`
+}
+
+// validObjectKey reports whether a client-supplied object key is safe to write to
+func validObjectKey(key string) bool {
+	if key == "" || len(key) > 1024 || strings.HasPrefix(key, "/") {
+		return false
+	}
+	for _, part := range strings.Split(key, "/") {
+		if part == "" || part == "." || part == ".." {
+			return false
+		}
+	}
+	return true
+}
+
+// rekeyPost handles POST requests that move a post's S3 object, and its thumbnail, to a new
+// key with server-side copies, update the post, then delete the old objects. The copies are
+// removed again if the post cannot be updated.
+func rekeyPost(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Rekeying requires the S3 storage backend")
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid post ID")
+		return
+	}
+	var req rekeyRequest
+	if err := c.ShouldBindJSON(&req); err != nil || !validObjectKey(req.Key) || !keyInTenant(c.Request.Context(), req.Key) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	ctx := c.Request.Context()
+	var doc postDocument
+	err = postsCollectionFor(ctx).FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching post from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	oldKey := objectKeyFor(doc)
+	if req.Key == oldKey {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "New key must differ from the current key")
+		return
+	}
+	shared, err := objectShared(ctx, oldKey, doc.ID)
+	if err != nil {
+		log.Printf("Error checking other posts for object %s: %v", oldKey, err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	if shared {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusConflict, codeConflict, "The object is shared with other posts and cannot be rekeyed")
+		return
+	}
+	exists, err := s3ObjectExists(ctx, req.Key)
+	if err != nil {
+		log.Printf("Error checking object %s in S3: %v", req.Key, err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to check object in S3")
+		return
+	}
+	if exists {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusConflict, codeConflict, "An object with this key already exists")
+		return
+	}
+
+	err = copyS3Object(ctx, oldKey, req.Key)
+	if isNotFound(err) {
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusNotFound, codeNotFound, "File not found in S3")
+		return
+	}
+	if err != nil {
+		log.Printf("Error copying object %s to %s in S3: %v", oldKey, req.Key, err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to copy object in S3")
+		return
+	}
+
+	set := bson.M{
+		"object_key": req.Key,
+		"picture":    s3URLPrefix() + req.Key,
+		"updated_at": time.Now(),
+	}
+	update := bson.M{"$set": set}
+	copied := []string{req.Key}
+	moved := []string{oldKey}
+	// The thumbnail follows the file; a missing one is dropped so backfill can regenerate it
+	if doc.ThumbnailURL != "" {
+		oldThumbnail, newThumbnail := thumbnailKey(oldKey), thumbnailKey(req.Key)
+		err = copyS3Object(ctx, oldThumbnail, newThumbnail)
+		switch {
+		case isNotFound(err):
+			update["$unset"] = bson.M{"thumbnail_url": ""}
+		case err != nil:
+			log.Printf("Error copying thumbnail %s to %s in S3: %v", oldThumbnail, newThumbnail, err)
+			rollbackRekey(copied)
+			recordError(c, errorCategoryS3)
+			respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to copy object in S3")
+			return
+		default:
+			set["thumbnail_url"] = s3URLPrefix() + newThumbnail
+			copied = append(copied, newThumbnail)
+			moved = append(moved, oldThumbnail)
+		}
+	}
+
+	var result postDocument
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = postsCollectionFor(ctx).FindOneAndUpdate(ctx, bson.M{"_id": id}, markModified(update), opts).Decode(&result)
+	if err != nil {
+		log.Printf("Error updating post in MongoDB, removing copied objects %v: %v", copied, err)
+		rollbackRekey(copied)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to update data in MongoDB")
+		return
+	}
+
+	// The post already points at the new keys, so a failed delete only leaves an orphan
+	for _, key := range moved {
+		if err := storage.Delete(ctx, key); err != nil {
+			log.Printf("Error deleting old object %s after rekey: %v", key, err)
+		}
+	}
+
+	recordAudit(c, auditActionUpdate, result.ID.Hex())
+	respond(c, http.StatusOK, toPostResponse(result), nil)
+}
+
+// copyS3Object makes a server-side copy of an object with the same read access as uploads
+func copyS3Object(ctx context.Context, from, to string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(to),
+		CopySource: aws.String(url.PathEscape(bucket + "/" + from)),
+	}
+	if s3GrantRead != "" {
+		input.GrantRead = aws.String(s3GrantRead)
+	} else {
+		input.ACL = aws.String("public-read")
+	}
+	_, err := s3Session.CopyObjectWithContext(ctx, input)
+	return err
+}
+
+// rollbackRekey removes the copies made by a rekey that could not be completed
+func rollbackRekey(keys []string) {
+	ctx, cancel := context.WithTimeout(context.Background(), rekeyRollbackTimeout)
+	defer cancel()
+	for _, key := range keys {
+		if err := storage.Delete(ctx, key); err != nil {
+			log.Printf("Error rolling back copied object %s: %v", key, err)
+		}
+	}
+}
@@ -0,0 +1,140 @@
+package main
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+	"syscall"
+
+	"github.com/gin-gonic/gin"
+)
+
+// remoteUploadRequest is the JSON body accepted by postSubmitURL
+type remoteUploadRequest struct {
+	Name       string `json:"name"`
+	Email      string `json:"email"`
+	PictureURL string `json:"picture_url" binding:"required"`
+}
+
+var (
+	errRemoteTooLarge = errors.New("remote file exceeds the size limit")
+	errRemoteNotImage = errors.New("remote file is not an image")
+)
+
+// postSubmitURL handles POST requests that submit a post with an image fetched from a remote URL
+func postSubmitURL(c *gin.Context) {
+	var req remoteUploadRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	target, err := url.Parse(req.PictureURL)
+	if err != nil || (target.Scheme != "http" && target.Scheme != "https") || target.Host == "" {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "picture_url must be an http or https URL")
+		return
+	}
+
+	data, err := fetchRemoteFile(c, target.String())
+	if err != nil {
+		log.Printf("Error fetching remote file %s: %v", target.Redacted(), err)
+		switch {
+		case errors.Is(err, errRemoteTooLarge):
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, "Remote file is too large")
+		case errors.Is(err, errRemoteNotImage):
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidFile, "Remote file is not an image")
+		default:
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Failed to fetch remote file")
+		}
+		return
+	}
+
+	filename := path.Base(target.Path)
+	if filename == "." || filename == "/" {
+		filename = "remote"
+	}
+	saveUpload(c, uploadMeta{Name: req.Name, Email: req.Email, Filename: filename}, bytes.NewReader(data))
+}
+
+// fetchRemoteFile downloads an image over HTTP(S) within the configured size and time limits
+func fetchRemoteFile(c *gin.Context, target string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(c.Request.Context(), http.MethodGet, target, nil)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := remoteHTTPClient().Do(req)
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("unexpected status %s", resp.Status)
+	}
+	if resp.ContentLength > remoteFetchMaxBytes {
+		return nil, errRemoteTooLarge
+	}
+
+	// Read one byte past the limit so oversized bodies are detected without trusting Content-Length
+	data, err := io.ReadAll(io.LimitReader(resp.Body, remoteFetchMaxBytes+1))
+	if err != nil {
+		return nil, err
+	}
+	if int64(len(data)) > remoteFetchMaxBytes {
+		return nil, errRemoteTooLarge
+	}
+	if !strings.HasPrefix(http.DetectContentType(data), "image/") {
+		return nil, errRemoteNotImage
+	}
+	return data, nil
+}
+
+// remoteHTTPClient returns an HTTP client that refuses to connect to non-public addresses
+func remoteHTTPClient() *http.Client {
+	dialer := &net.Dialer{
+		Timeout: remoteFetchTimeout,
+		// Checking the resolved address at dial time also covers redirects and DNS rebinding
+		Control: func(network, address string, _ syscall.RawConn) error {
+			host, _, err := net.SplitHostPort(address)
+			if err != nil {
+				return err
+			}
+			ip := net.ParseIP(host)
+			if ip == nil || !isPublicIP(ip) {
+				return fmt.Errorf("refusing to connect to non-public address %s", host)
+			}
+			return nil
+		},
+	}
+	return &http.Client{
+		Timeout:   remoteFetchTimeout,
+		Transport: &http.Transport{DialContext: dialer.DialContext},
+		CheckRedirect: func(req *http.Request, via []*http.Request) error {
+			if len(via) >= 5 {
+				return errors.New("too many redirects")
+			}
+			if req.URL.Scheme != "http" && req.URL.Scheme != "https" {
+				return errors.New("redirect to unsupported scheme")
+			}
+			return nil
+		},
+	}
+}
+
+// isPublicIP reports whether an IP address is routable on the public internet
+func isPublicIP(ip net.IP) bool {
+	return !(ip.IsLoopback() || ip.IsPrivate() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast())
+}
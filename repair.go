@@ -0,0 +1,102 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// repairPost handles POST requests that re-upload a post's file from a backup copy.
+// The replacement is written under the original object key and must match the stored hash.
+func repairPost(c *gin.Context) {
+	defer cleanupMultipart(c)
+
+	// The replacement is verified with an S3 HeadObject, which the local backend cannot answer
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Repair requires the S3 storage backend")
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid post ID")
+		return
+	}
+
+	var doc postDocument
+	err = postsCollectionFor(c.Request.Context()).FindOne(c.Request.Context(), bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching post from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	if err := c.Request.ParseMultipartForm(multipartMemory); err != nil {
+		log.Printf("Error parsing multipart form: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+		return
+	}
+	file, _, err := c.Request.FormFile(uploadFieldName)
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+		return
+	}
+	defer file.Close()
+
+	md5Hex, sha256Hex, err := fileDigests(file)
+	if err != nil {
+		log.Printf("Error reading uploaded file: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+		return
+	}
+	if (doc.ContentSHA256 != "" && sha256Hex != doc.ContentSHA256) ||
+		(doc.ContentSHA256 == "" && doc.ContentMD5 != "" && md5Hex != doc.ContentMD5) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusUnprocessableEntity, codeInvalidFile, "Replacement file does not match the stored content hash")
+		return
+	}
+
+	contentType := doc.ContentType
+	if contentType == "" {
+		if contentType, err = detectContentType(file); err != nil {
+			log.Printf("Error reading uploaded file: %v", err)
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file upload")
+			return
+		}
+	}
+
+	key := objectKeyFor(doc)
+	if _, err := storage.Put(c.Request.Context(), key, file, contentType, withOverwrite()); err != nil {
+		log.Printf("Error re-uploading %s to S3: %v", key, err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to upload image to S3")
+		return
+	}
+
+	result, err := verifyPostObject(c.Request.Context(), doc)
+	if err != nil {
+		log.Printf("Error verifying object in S3: %v", err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to verify object in S3")
+		return
+	}
+	log.Printf("Repaired object %s for post %s", key, doc.ID.Hex())
+	recordAudit(c, auditActionRepair, doc.ID.Hex())
+	respond(c, http.StatusOK, gin.H{"id": result.ID, "consistent": result.consistent(), "verification": result}, nil)
+}
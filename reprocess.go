@@ -0,0 +1,255 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"os"
+	"strconv"
+	"sync"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// reprocessResult summarises a bulk reprocess run
+type reprocessResult struct {
+	Processed int `json:"processed"`
+	Failed    int `json:"failed"`
+}
+
+// reprocessPost handles POST requests that re-read one post's file from storage and
+// re-run the upload enrichment on it, responding with the updated post
+func reprocessPost(c *gin.Context) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid post ID")
+		return
+	}
+
+	ctx := c.Request.Context()
+	var doc postDocument
+	err = postsCollectionFor(ctx).FindOne(ctx, bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching post from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	set, err := reprocessFields(ctx, doc)
+	if isNotFound(err) || errors.Is(err, os.ErrNotExist) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "File not found")
+		return
+	}
+	if errors.Is(err, errImageTooLarge) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusUnprocessableEntity, codeInvalidFile, fmt.Sprintf("Image exceeds the maximum of %d pixels", maxImagePixels))
+		return
+	}
+	if err != nil {
+		log.Printf("Error reprocessing post %s: %v", id.Hex(), err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to reprocess the stored file")
+		return
+	}
+	updated, err := applyReprocess(ctx, id, set)
+	if err != nil {
+		log.Printf("Error updating post in MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to update data in MongoDB")
+		return
+	}
+
+	recordAudit(c, auditActionReprocess, id.Hex())
+	respond(c, http.StatusOK, toPostResponse(updated), nil)
+}
+
+// reprocessPosts handles POST requests that reprocess up to ?limit= posts with a pool of
+// REPROCESS_WORKERS workers. Posts already reprocessed are skipped unless they were
+// reprocessed before ?since=, so repeated calls work through the whole collection.
+func reprocessPosts(c *gin.Context) {
+	limit := defaultBackfillLimit
+	if value := c.Query("limit"); value != "" {
+		n, err := strconv.Atoi(value)
+		if err != nil || n < 1 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(n, maxBackfillLimit)
+	}
+	filter := bson.M{"reprocessed_at": bson.M{"$exists": false}}
+	if value := c.Query("since"); value != "" {
+		since, err := time.Parse(time.RFC3339, value)
+		if err != nil {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "since must be an RFC 3339 timestamp")
+			return
+		}
+		filter = bson.M{"$or": bson.A{filter, bson.M{"reprocessed_at": bson.M{"$lt": since}}}}
+	}
+
+	opts := options.Find().
+		SetSort(bson.D{{Key: "created_at", Value: 1}}).
+		SetLimit(int64(limit)).
+		SetBatchSize(backfillBatchSize)
+	ctx := c.Request.Context()
+	cursor, err := postsCollectionFor(ctx).Find(ctx, filter, opts)
+	if err != nil {
+		log.Printf("Error fetching posts to reprocess from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var (
+		result reprocessResult
+		mu     sync.Mutex
+		wg     sync.WaitGroup
+	)
+	docs := make(chan postDocument)
+	for i := 0; i < reprocessWorkers; i++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			for doc := range docs {
+				set, err := reprocessFields(ctx, doc)
+				if err == nil {
+					_, err = applyReprocess(ctx, doc.ID, set)
+				}
+				if err != nil {
+					log.Printf("Error reprocessing post %s: %v", doc.ID.Hex(), err)
+				}
+				mu.Lock()
+				result.Processed++
+				if err != nil {
+					result.Failed++
+				}
+				if result.Processed%backfillBatchSize == 0 {
+					log.Printf("Reprocess progress: %d processed, %d failed", result.Processed, result.Failed)
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+	for cursor.Next(ctx) {
+		var doc postDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Error decoding post during reprocess: %v", err)
+			mu.Lock()
+			result.Failed++
+			mu.Unlock()
+			continue
+		}
+		docs <- doc
+	}
+	close(docs)
+	wg.Wait()
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error iterating posts during reprocess: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	log.Printf("Reprocess finished: %d processed, %d failed", result.Processed, result.Failed)
+	respond(c, http.StatusOK, result, nil)
+}
+
+// reprocessFields downloads a post's file and recomputes its size, digests, dimensions,
+// page count, location and missing thumbnail as a $set document stamped with reprocessed_at.
+// Existing thumbnails are kept, since no-overwrite mode would refuse to replace them.
+func reprocessFields(ctx context.Context, doc postDocument) (bson.M, error) {
+	key := objectKeyFor(doc)
+	object, err := storage.Get(ctx, key)
+	if err != nil {
+		return nil, err
+	}
+	data, err := io.ReadAll(object)
+	object.Close()
+	if err != nil {
+		return nil, err
+	}
+
+	file := bytes.NewReader(data)
+	size := int64(len(data))
+	contentMD5, contentSHA256, err := fileDigests(file)
+	if err != nil {
+		return nil, err
+	}
+	set := bson.M{
+		"size_bytes":     size,
+		"content_md5":    contentMD5,
+		"content_sha256": contentSHA256,
+		"reprocessed_at": time.Now(),
+	}
+
+	contentType := doc.ContentType
+	if contentType == "" {
+		if contentType, err = detectContentType(file); err != nil {
+			return nil, err
+		}
+		set["content_type"] = contentType
+	}
+
+	if isDecodableImage(contentType) {
+		if err := checkImagePixels(file); err != nil {
+			return nil, err
+		}
+		if width, height, ok, err := imageDimensions(file); err != nil {
+			return nil, err
+		} else if ok {
+			set["width"], set["height"] = width, height
+		}
+		if extractGeo && contentType == "image/jpeg" {
+			location, found, err := extractGPS(file)
+			if err != nil {
+				return nil, err
+			}
+			if found {
+				set["location"] = location
+			}
+		}
+		if generateThumbnails && doc.ThumbnailURL == "" {
+			thumbnailURL, err := createThumbnail(ctx, file, key)
+			if err != nil {
+				return nil, err
+			}
+			set["thumbnail_url"] = thumbnailURL
+		}
+	}
+	if contentType == "application/pdf" {
+		n, err := pdfPageCount(file, size)
+		if err != nil {
+			return nil, err
+		}
+		set["page_count"] = n
+	}
+
+	return set, nil
+}
+
+// applyReprocess stores reprocessed fields on a post and returns the updated post
+func applyReprocess(ctx context.Context, id primitive.ObjectID, set bson.M) (postDocument, error) {
+	var updated postDocument
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err := postsCollectionFor(ctx).FindOneAndUpdate(ctx, bson.M{"_id": id}, markModified(bson.M{"$set": set}), opts).Decode(&updated)
+	return updated, err
+}
@@ -0,0 +1,44 @@
+package main
+
+import (
+	"regexp"
+
+	"github.com/gin-gonic/gin"
+	"github.com/google/uuid"
+)
+
+// requestIDKey is the context key holding the current request's ID
+const requestIDKey = "request_id"
+
+// requestIDPattern restricts client-supplied request IDs to safe header and log values
+var requestIDPattern = regexp.MustCompile(`^[A-Za-z0-9._-]{1,128}$`)
+
+// requestID assigns every request an ID, reusing a valid incoming X-Request-ID, and echoes it back
+func requestID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Request-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set(requestIDKey, id)
+		c.Header("X-Request-ID", id)
+		c.Next()
+	}
+}
+
+// correlationIDKey is the context key holding the gateway correlation ID of a request
+const correlationIDKey = "correlation_id"
+
+// correlationID carries an upstream X-Correlation-ID through the request, generating
+// one when absent, and echoes it back so records can be traced to the gateway request
+func correlationID() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		id := c.GetHeader("X-Correlation-ID")
+		if !requestIDPattern.MatchString(id) {
+			id = uuid.NewString()
+		}
+		c.Set(correlationIDKey, id)
+		c.Header("X-Correlation-ID", id)
+		c.Next()
+	}
+}
@@ -0,0 +1,79 @@
+package main
+
+import (
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+)
+
+// useEnvelope is set from API_RESPONSE_ENVELOPE and switches every handler to enveloped responses
+var useEnvelope bool
+
+// respond writes a successful response, wrapped as {"data":...,"meta":...} when the envelope is enabled
+func respond(c *gin.Context, status int, data any, meta gin.H) {
+	if useEnvelope {
+		c.JSON(status, gin.H{"data": data, "meta": meta})
+		return
+	}
+	c.JSON(status, data)
+}
+
+// respondList writes a list response. Without the envelope the meta fields are
+// returned alongside the items under itemsKey, as the list endpoints always have.
+func respondList(c *gin.Context, status int, itemsKey string, items any, meta gin.H) {
+	if useEnvelope {
+		c.JSON(status, gin.H{"data": items, "meta": meta})
+		return
+	}
+	body := gin.H{itemsKey: items}
+	for key, value := range meta {
+		body[key] = value
+	}
+	c.JSON(status, body)
+}
+
+// Machine-readable error codes returned with every error response
+const (
+	codeInvalidRequest       = "invalid_request"
+	codeInvalidFile          = "invalid_file"
+	codeFileTooLarge         = "file_too_large"
+	codeQuotaExceeded        = "quota_exceeded"
+	codeUnsupportedMediaType = "unsupported_media_type"
+	codeNotAcceptable        = "not_acceptable"
+	codeUnauthorized         = "unauthorized"
+	codeForbidden            = "forbidden"
+	codeNotFound             = "not_found"
+	codeConflict             = "conflict"
+	codeNotImplemented       = "not_implemented"
+	codeUnavailable          = "unavailable"
+	codeS3Failure            = "s3_failure"
+	codeMongoFailure         = "mongo_failure"
+	codeTimeout              = "timeout"
+	codeExpired              = "expired"
+)
+
+// respondError writes an error response as {"error":...,"code":...}, or as
+// {"error":{"message":...,"code":...}} when the envelope is enabled
+func respondError(c *gin.Context, status int, code, message string) {
+	respondErrorDetails(c, status, code, message, nil)
+}
+
+// respondErrorDetails writes an error response carrying extra fields alongside the message and code
+func respondErrorDetails(c *gin.Context, status int, code, message string, details gin.H) {
+	// Failures caused by the client's own deadline are reported as such rather than as 5xx faults
+	if clientDeadlineExceeded(c) {
+		status, code, message, details = http.StatusGatewayTimeout, codeTimeout, "Request deadline exceeded", nil
+	}
+	body := gin.H{}
+	for key, value := range details {
+		body[key] = value
+	}
+	body["code"] = code
+	if useEnvelope {
+		body["message"] = message
+		c.JSON(status, gin.H{"error": body})
+		return
+	}
+	body["error"] = message
+	c.JSON(status, body)
+}
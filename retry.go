@@ -0,0 +1,59 @@
+package main
+
+import (
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/client"
+	"github.com/aws/aws-sdk-go/aws/request"
+)
+
+// budgetedOperations are the upload calls whose retries S3_RETRY_MAX_ELAPSED bounds;
+// s3manager sends large files as UploadPart calls rather than a single PutObject
+var budgetedOperations = []string{"PutObject", "UploadPart"}
+
+// budgetRetryer retries like the SDK's DefaultRetryer, up to S3_MAX_RETRIES times, but stops
+// retrying an upload call once S3_RETRY_MAX_ELAPSED has passed since it was first sent
+type budgetRetryer struct {
+	client.DefaultRetryer
+	maxElapsed time.Duration
+}
+
+// newS3Retryer returns the retryer used by the S3 client
+func newS3Retryer(maxRetries int, maxElapsed time.Duration) budgetRetryer {
+	return budgetRetryer{
+		DefaultRetryer: client.DefaultRetryer{NumMaxRetries: maxRetries},
+		maxElapsed:     maxElapsed,
+	}
+}
+
+// ShouldRetry reports whether a failed request should be retried, logging which limit ended
+// the retries of an upload call
+func (b budgetRetryer) ShouldRetry(r *request.Request) bool {
+	if !b.DefaultRetryer.ShouldRetry(r) {
+		return false
+	}
+	if !containsString(budgetedOperations, r.Operation.Name) {
+		return true
+	}
+	attempts := r.RetryCount + 1
+	if r.RetryCount >= b.MaxRetries() {
+		log.Printf("S3 %s failed after %d attempts: retry attempts exhausted (S3_MAX_RETRIES=%d)", r.Operation.Name, attempts, b.MaxRetries())
+		return false
+	}
+	if elapsed := time.Since(r.Time); b.maxElapsed > 0 && elapsed >= b.maxElapsed {
+		log.Printf("S3 %s failed after %d attempts in %s: retry time budget exhausted (S3_RETRY_MAX_ELAPSED=%s)", r.Operation.Name, attempts, elapsed.Round(time.Millisecond), b.maxElapsed)
+		return false
+	}
+	return true
+}
+
+// RetryRules returns the backoff before the next attempt, cut short so an upload call never
+// sleeps past its S3_RETRY_MAX_ELAPSED budget
+func (b budgetRetryer) RetryRules(r *request.Request) time.Duration {
+	delay := b.DefaultRetryer.RetryRules(r)
+	if b.maxElapsed > 0 && containsString(budgetedOperations, r.Operation.Name) {
+		delay = min(delay, max(b.maxElapsed-time.Since(r.Time), 0))
+	}
+	return delay
+}
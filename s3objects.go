@@ -0,0 +1,74 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+)
+
+const (
+	defaultObjectListSize = 100
+	maxObjectListSize     = 1000
+)
+
+// s3ObjectInfo is the JSON shape of a single listed S3 object
+type s3ObjectInfo struct {
+	Key          string    `json:"key"`
+	Size         int64     `json:"size"`
+	LastModified time.Time `json:"last_modified"`
+}
+
+// listS3Objects handles GET requests to page through the bucket contents under a prefix
+func listS3Objects(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Object listing requires the S3 storage backend")
+		return
+	}
+
+	maxKeys := int64(defaultObjectListSize)
+	if value := c.Query("limit"); value != "" {
+		limit, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || limit < 1 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid limit")
+			return
+		}
+		maxKeys = min(limit, maxObjectListSize)
+	}
+
+	input := &s3.ListObjectsV2Input{
+		Bucket:  aws.String(bucket),
+		Prefix:  aws.String(c.Query("prefix")),
+		MaxKeys: aws.Int64(maxKeys),
+	}
+	if token := c.Query("continuation"); token != "" {
+		input.ContinuationToken = aws.String(token)
+	}
+
+	output, err := s3Session.ListObjectsV2WithContext(c.Request.Context(), input)
+	if err != nil {
+		log.Printf("Error listing objects in S3: %v", err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to list objects in S3")
+		return
+	}
+
+	objects := make([]s3ObjectInfo, 0, len(output.Contents))
+	for _, object := range output.Contents {
+		objects = append(objects, s3ObjectInfo{
+			Key:          aws.StringValue(object.Key),
+			Size:         aws.Int64Value(object.Size),
+			LastModified: aws.TimeValue(object.LastModified),
+		})
+	}
+
+	respondList(c, http.StatusOK, "objects", objects, gin.H{
+		"next_continuation": aws.StringValue(output.NextContinuationToken),
+		"truncated":         aws.BoolValue(output.IsTruncated),
+	})
+}
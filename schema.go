@@ -0,0 +1,49 @@
+package main
+
+import (
+	"context"
+	"log"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// postsValidator is the JSON schema applied to posts collections
+var postsValidator = bson.M{
+	"$jsonSchema": bson.M{
+		"bsonType": "object",
+		"required": bson.A{"name", "email", "picture", "created_at"},
+		"properties": bson.M{
+			"name":       bson.M{"bsonType": "string"},
+			"email":      bson.M{"bsonType": "string"},
+			"picture":    bson.M{"bsonType": "string"},
+			"created_at": bson.M{"bsonType": "date"},
+		},
+	},
+}
+
+// ensurePostsCollection applies the validation schema to the request's posts collection,
+// creating it with the schema if it does not exist yet and updating it with collMod if it
+// does. It must run before anything else creates the collection, such as its indexes.
+func ensurePostsCollection(ctx context.Context) error {
+	db := mongoClient.Database(dbName)
+	name := postsCollectionFor(ctx).Name()
+	names, err := db.ListCollectionNames(ctx, bson.M{"name": name})
+	if err != nil {
+		return err
+	}
+	if len(names) > 0 {
+		err := db.RunCommand(ctx, bson.D{{Key: "collMod", Value: name}, {Key: "validator", Value: postsValidator}}).Err()
+		if err != nil {
+			return err
+		}
+		log.Printf("Applied validation schema to existing collection %s", name)
+		return nil
+	}
+
+	if err := db.CreateCollection(ctx, name, options.CreateCollection().SetValidator(postsValidator)); err != nil {
+		return err
+	}
+	log.Printf("Created collection %s with validation schema", name)
+	return nil
+}
@@ -0,0 +1,374 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// Upload session states
+const (
+	sessionStatusPending    = "pending"
+	sessionStatusConfirming = "confirming"
+	sessionStatusConfirmed  = "confirmed"
+	sessionStatusExpired    = "expired"
+)
+
+// uploadKindPresign marks the sessions recorded by POST /admin/uploads/presign, which are
+// confirmed through POST /admin/posts/confirm rather than the session endpoint
+const uploadKindPresign = "presign"
+
+// uploadSessionRequest is the body of POST /admin/uploads/session
+type uploadSessionRequest struct {
+	Filename    string `json:"filename" binding:"required"`
+	ContentType string `json:"content_type" binding:"required"`
+	Name        string `json:"name"`
+	Email       string `json:"email"`
+}
+
+// uploadSession is a pending direct upload recorded until the client confirms it
+type uploadSession struct {
+	ID          primitive.ObjectID  `bson:"_id,omitempty"`
+	Kind        string              `bson:"kind,omitempty"`
+	Key         string              `bson:"key"`
+	Filename    string              `bson:"filename"`
+	ContentType string              `bson:"content_type"`
+	MaxBytes    int64               `bson:"max_bytes"`
+	Name        string              `bson:"name"`
+	Email       string              `bson:"email"`
+	EmailRaw    string              `bson:"email_raw,omitempty"`
+	EmailHash   string              `bson:"email_hash,omitempty"`
+	Status      string              `bson:"status"`
+	PostID      *primitive.ObjectID `bson:"post_id,omitempty"`
+	ExpiresAt   time.Time           `bson:"expires_at"`
+	CreatedAt   time.Time           `bson:"created_at"`
+}
+
+// submittedEmail returns the email as the client submitted it, decrypted when ENCRYPT_PII
+// stored it encrypted, so the post stores it exactly like a multipart upload would
+func (s uploadSession) submittedEmail() string {
+	if s.EmailRaw != "" {
+		return readEmail(s.EmailRaw)
+	}
+	return readEmail(s.Email)
+}
+
+// uploadSessionResponse tells the client where to PUT the file and where it will be served from
+type uploadSessionResponse struct {
+	SessionID   string            `json:"session_id"`
+	Key         string            `json:"key"`
+	UploadURL   string            `json:"upload_url"`
+	Method      string            `json:"method"`
+	Headers     map[string]string `json:"headers"`
+	DownloadURL string            `json:"download_url"`
+	ContentType string            `json:"content_type"`
+	MaxBytes    int64             `json:"max_bytes"`
+	ExpiresAt   time.Time         `json:"expires_at"`
+}
+
+// uploadSessionsCollection returns the collection holding pending upload sessions
+func uploadSessionsCollection() *mongo.Collection {
+	return mongoClient.Database(dbName).Collection(uploadSessionCollName)
+}
+
+// createUploadSession handles POST requests that record a pending upload and return a
+// presigned PUT URL for it, along with the URL the file will be served from once confirmed
+func createUploadSession(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Direct uploads require the S3 storage backend")
+		return
+	}
+
+	var req uploadSessionRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
+		return
+	}
+	if req.Email != "" && !validEmail(req.Email) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid email address")
+		return
+	}
+	if extensionBlocked(req.Filename) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusUnsupportedMediaType, codeUnsupportedMediaType, "File extension is blocked")
+		return
+	}
+	if !extensionAllowed(req.Filename) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "File extension is not allowed")
+		return
+	}
+	if !contentTypeAllowed(req.ContentType) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "File type is not allowed")
+		return
+	}
+	key, err := buildKey(c.Request.Context(), req.Filename, "")
+	if err != nil {
+		log.Printf("Error building object key: %v", err)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidFile, "Invalid file name")
+		return
+	}
+
+	// The signed headers must be sent with the PUT exactly as returned
+	contentType := mediaType(req.ContentType)
+	input := &s3.PutObjectInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(key),
+		ContentType: aws.String(contentType),
+	}
+	headers := map[string]string{"Content-Type": contentType}
+	if s3GrantRead != "" {
+		input.GrantRead = aws.String(s3GrantRead)
+		headers["x-amz-grant-read"] = s3GrantRead
+	} else {
+		input.ACL = aws.String("public-read")
+		headers["x-amz-acl"] = "public-read"
+	}
+	putRequest, _ := s3Session.PutObjectRequest(input)
+	uploadURL, err := putRequest.Presign(presignExpiry)
+	if err != nil {
+		log.Printf("Error presigning S3 upload: %v", err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to presign S3 upload")
+		return
+	}
+
+	// The email is held the way posts hold it, so ENCRYPT_PII also covers pending sessions
+	email, err := emailFields(req.Email)
+	if err != nil {
+		log.Printf("Error encrypting email: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to save data to MongoDB")
+		return
+	}
+	now := time.Now()
+	session := uploadSession{
+		Key:         key,
+		Filename:    req.Filename,
+		ContentType: contentType,
+		MaxBytes:    presignMaxBytes,
+		Name:        req.Name,
+		Email:       email["email"].(string),
+		Status:      sessionStatusPending,
+		ExpiresAt:   now.Add(presignExpiry),
+		CreatedAt:   now,
+	}
+	session.EmailRaw, _ = email["email_raw"].(string)
+	session.EmailHash, _ = email["email_hash"].(string)
+	result, err := uploadSessionsCollection().InsertOne(c.Request.Context(), session)
+	if err != nil {
+		log.Printf("Error saving upload session to MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to save data to MongoDB")
+		return
+	}
+	id, _ := result.InsertedID.(primitive.ObjectID)
+
+	respond(c, http.StatusOK, uploadSessionResponse{
+		SessionID:   id.Hex(),
+		Key:         key,
+		UploadURL:   uploadURL,
+		Method:      http.MethodPut,
+		Headers:     headers,
+		DownloadURL: publicURL(key, s3URLPrefix()+key),
+		ContentType: contentType,
+		MaxBytes:    session.MaxBytes,
+		ExpiresAt:   session.ExpiresAt,
+	}, nil)
+}
+
+// confirmUploadSession handles POST requests that finalize a pending upload session once
+// the client has PUT the file, checking and processing it like a multipart upload
+func confirmUploadSession(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Direct uploads require the S3 storage backend")
+		return
+	}
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid upload session ID")
+		return
+	}
+
+	// Presigned POST keys are confirmed through /admin/posts/confirm with the client's own details
+	session, ok := claimUploadSession(c, bson.M{"_id": id, "kind": bson.M{"$ne": uploadKindPresign}})
+	if !ok {
+		return
+	}
+	confirmDirectUpload(c, session, uploadMeta{Name: session.Name, Email: session.submittedEmail()})
+}
+
+// claimUploadSession atomically moves the pending session matching filter to confirming, so
+// concurrent confirmations cannot both create a post. It writes the error response and
+// reports false when there is no pending, unexpired session to confirm. Sessions whose key
+// is outside the request tenant are reported as not found, so tenants cannot confirm each
+// other's uploads.
+func claimUploadSession(c *gin.Context, filter bson.M) (uploadSession, bool) {
+	ctx := c.Request.Context()
+	claim := bson.M{"status": sessionStatusPending, "expires_at": bson.M{"$gt": time.Now()}}
+	for field, value := range filter {
+		claim[field] = value
+	}
+	var session uploadSession
+	update := bson.M{"$set": bson.M{"status": sessionStatusConfirming}}
+	err := uploadSessionsCollection().FindOneAndUpdate(ctx, claim, update).Decode(&session)
+	if err == nil && !keyInTenant(ctx, session.Key) {
+		setUploadSessionStatus(ctx, session.ID, bson.M{"status": sessionStatusPending})
+		err = mongo.ErrNoDocuments
+	}
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		var existing uploadSession
+		err = uploadSessionsCollection().FindOne(ctx, filter).Decode(&existing)
+		if errors.Is(err, mongo.ErrNoDocuments) || (err == nil && !keyInTenant(ctx, existing.Key)) {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusNotFound, codeNotFound, "Upload session not found")
+			return session, false
+		}
+		if err == nil {
+			rejectUnclaimedSession(c, existing)
+			return session, false
+		}
+	}
+	if err != nil {
+		log.Printf("Error fetching upload session from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return session, false
+	}
+	return session, true
+}
+
+// rejectUnclaimedSession responds for a session that exists but could not be claimed: 410 once
+// it has expired, removing the object of a pending one, and 409 while it is confirmed or
+// another request is confirming it
+func rejectUnclaimedSession(c *gin.Context, session uploadSession) {
+	recordError(c, errorCategoryValidation)
+	switch {
+	case session.Status == sessionStatusExpired:
+		respondError(c, http.StatusGone, codeExpired, "Upload session has expired")
+	case session.Status == sessionStatusPending && time.Now().After(session.ExpiresAt):
+		setUploadSessionStatus(c.Request.Context(), session.ID, bson.M{"status": sessionStatusExpired})
+		deleteStagedObject(c.Request.Context(), session.Key)
+		respondError(c, http.StatusGone, codeExpired, "Upload session has expired")
+	case session.Status == sessionStatusConfirmed:
+		respondError(c, http.StatusConflict, codeConflict, "Upload has already been confirmed")
+	default:
+		// Confirming, or pending again after a concurrent confirmation gave up on it
+		respondError(c, http.StatusConflict, codeConflict, "Upload is already being confirmed")
+	}
+}
+
+// confirmDirectUpload turns the object uploaded for a claimed session into a post. The object
+// goes through saveUpload like a multipart upload and is replaced by the processed file; it is
+// deleted when rejected, and the session returns to pending so the client can upload again.
+func confirmDirectUpload(c *gin.Context, session uploadSession, meta uploadMeta) {
+	ctx := c.Request.Context()
+	head, err := s3Session.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(session.Key),
+	})
+	if isNotFound(err) {
+		setUploadSessionStatus(ctx, session.ID, bson.M{"status": sessionStatusPending})
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Uploaded object not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error checking uploaded object in S3: %v", err)
+		setUploadSessionStatus(ctx, session.ID, bson.M{"status": sessionStatusPending})
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to verify object in S3")
+		return
+	}
+
+	// Neither limit can be trusted to the client, so oversized objects are removed before download
+	size := aws.Int64Value(head.ContentLength)
+	limit := session.MaxBytes
+	if ceiling := uploadCeiling(); ceiling > 0 && (limit <= 0 || ceiling < limit) {
+		limit = ceiling
+	}
+	if limit > 0 && size > limit {
+		rejectDirectUpload(ctx, session)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, fmt.Sprintf("Upload exceeds the maximum of %d bytes", limit))
+		return
+	}
+	if session.ContentType != "" && mediaType(aws.StringValue(head.ContentType)) != session.ContentType {
+		rejectDirectUpload(ctx, session)
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusUnprocessableEntity, codeInvalidFile, "Uploaded content type does not match the session")
+		return
+	}
+
+	object, err := storage.Get(ctx, session.Key)
+	if err != nil {
+		log.Printf("Error downloading uploaded object %s: %v", session.Key, err)
+		setUploadSessionStatus(ctx, session.ID, bson.M{"status": sessionStatusPending})
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to read object from S3")
+		return
+	}
+	data, err := io.ReadAll(io.LimitReader(object, size))
+	object.Close()
+	if err != nil {
+		log.Printf("Error downloading uploaded object %s: %v", session.Key, err)
+		setUploadSessionStatus(ctx, session.ID, bson.M{"status": sessionStatusPending})
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to read object from S3")
+		return
+	}
+
+	meta.Key = session.Key
+	if meta.Filename == "" {
+		meta.Filename = session.Filename
+	}
+	postID, key, ok := saveUpload(c, meta, bytes.NewReader(data))
+	if !ok {
+		rejectDirectUpload(ctx, session)
+		return
+	}
+	// A duplicate of stored content references the existing object instead
+	if key != session.Key {
+		deleteStagedObject(ctx, session.Key)
+	}
+	setUploadSessionStatus(ctx, session.ID, bson.M{"status": sessionStatusConfirmed, "post_id": postID})
+}
+
+// rejectDirectUpload deletes an object that failed confirmation and returns its session to pending
+func rejectDirectUpload(ctx context.Context, session uploadSession) {
+	deleteStagedObject(ctx, session.Key)
+	setUploadSessionStatus(ctx, session.ID, bson.M{"status": sessionStatusPending})
+}
+
+// deleteStagedObject removes a directly uploaded object that no post will reference
+func deleteStagedObject(ctx context.Context, key string) {
+	if err := storage.Delete(context.WithoutCancel(ctx), key); err != nil {
+		log.Printf("Error deleting uploaded object %s: %v", key, err)
+	}
+}
+
+// setUploadSessionStatus updates a session even when the request has been cancelled, so a
+// claimed session is never left stuck in confirming
+func setUploadSessionStatus(ctx context.Context, id primitive.ObjectID, set bson.M) {
+	_, err := uploadSessionsCollection().UpdateOne(context.WithoutCancel(ctx), bson.M{"_id": id}, bson.M{"$set": set})
+	if err != nil {
+		log.Printf("Error updating upload session %s: %v", id.Hex(), err)
+	}
+}
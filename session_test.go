@@ -0,0 +1,178 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestConfirmUploadSessionRejectsOtherTenants(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previousTenants, previousBackend := tenants, storageBackend
+	tenants, storageBackend = []string{"acme", "globex"}, "s3"
+	defer func() { tenants, storageBackend = previousTenants, previousBackend }()
+
+	id := primitive.NewObjectID()
+	session := func(key, status string) bson.D {
+		return bson.D{
+			{Key: "_id", Value: id},
+			{Key: "key", Value: key},
+			{Key: "status", Value: status},
+			{Key: "expires_at", Value: time.Now().Add(time.Hour)},
+		}
+	}
+	tests := []struct {
+		name      string
+		tenant    string
+		claimed   bson.D
+		existing  bson.D
+		wantCalls []string
+	}{
+		{
+			name:      "pending session of another tenant",
+			tenant:    "acme",
+			claimed:   session("tenants/globex/photo.jpg", sessionStatusPending),
+			existing:  session("tenants/globex/photo.jpg", sessionStatusPending),
+			wantCalls: []string{"findAndModify", "update", "find"},
+		},
+		{
+			name:      "confirmed session of another tenant",
+			tenant:    "acme",
+			existing:  session("tenants/globex/photo.jpg", sessionStatusConfirmed),
+			wantCalls: []string{"findAndModify", "find"},
+		},
+		{
+			name:      "tenant session from the default tenant",
+			claimed:   session("tenants/globex/photo.jpg", sessionStatusPending),
+			existing:  session("tenants/globex/photo.jpg", sessionStatusPending),
+			wantCalls: []string{"findAndModify", "update", "find"},
+		},
+		{
+			name:      "unknown session",
+			tenant:    "acme",
+			wantCalls: []string{"findAndModify", "find"},
+		},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			useMockMongo(mt)
+			var claimed interface{}
+			if tt.claimed != nil {
+				claimed = tt.claimed
+			}
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: claimed}))
+			if tt.claimed != nil {
+				mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+			}
+			var batch []bson.D
+			if tt.existing != nil {
+				batch = append(batch, tt.existing)
+			}
+			mt.AddMockResponses(mtest.CreateCursorResponse(0, "test.upload_sessions", mtest.FirstBatch, batch...))
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/admin/uploads/session/"+id.Hex()+"/confirm", nil)
+			if tt.tenant != "" {
+				c.Request = c.Request.WithContext(withTenant(context.Background(), tt.tenant))
+			}
+			c.Params = gin.Params{{Key: "id", Value: id.Hex()}}
+			confirmUploadSession(c)
+
+			if w.Code != http.StatusNotFound {
+				mt.Errorf("status = %d, want %d: %s", w.Code, http.StatusNotFound, w.Body.String())
+			}
+			var calls []string
+			for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+				calls = append(calls, event.CommandName)
+			}
+			if len(calls) != len(tt.wantCalls) {
+				mt.Fatalf("commands = %v, want %v", calls, tt.wantCalls)
+			}
+			for i := range calls {
+				if calls[i] != tt.wantCalls[i] {
+					mt.Errorf("commands = %v, want %v", calls, tt.wantCalls)
+				}
+			}
+		})
+	}
+}
+
+func TestClaimUploadSession(t *testing.T) {
+	gin.SetMode(gin.TestMode)
+	previousTenants, previousStorage := tenants, storage
+	tenants, storage = nil, &localStorage{dir: t.TempDir(), baseURL: "http://localhost/files"}
+	defer func() { tenants, storage = previousTenants, previousStorage }()
+
+	id := primitive.NewObjectID()
+	session := func(status string, expiresIn time.Duration) bson.D {
+		return bson.D{
+			{Key: "_id", Value: id},
+			{Key: "key", Value: "photo.jpg"},
+			{Key: "status", Value: status},
+			{Key: "expires_at", Value: time.Now().Add(expiresIn)},
+		}
+	}
+	tests := []struct {
+		name       string
+		claimed    bson.D
+		existing   bson.D
+		wantOK     bool
+		wantStatus int
+		wantCalls  []string
+	}{
+		{"pending", session(sessionStatusPending, time.Hour), nil, true, http.StatusOK, []string{"findAndModify"}},
+		{"confirmed", nil, session(sessionStatusConfirmed, time.Hour), false, http.StatusConflict, []string{"findAndModify", "find"}},
+		{"being confirmed", nil, session(sessionStatusConfirming, time.Hour), false, http.StatusConflict, []string{"findAndModify", "find"}},
+		{"expired", nil, session(sessionStatusExpired, -time.Hour), false, http.StatusGone, []string{"findAndModify", "find"}},
+		{"pending past its expiry", nil, session(sessionStatusPending, -time.Hour), false, http.StatusGone, []string{"findAndModify", "find", "update"}},
+	}
+
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			useMockMongo(mt)
+			var claimed interface{}
+			if tt.claimed != nil {
+				claimed = tt.claimed
+			}
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "value", Value: claimed}))
+			if tt.existing != nil {
+				mt.AddMockResponses(
+					mtest.CreateCursorResponse(0, "test.upload_sessions", mtest.FirstBatch, tt.existing),
+					mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}),
+				)
+			}
+
+			w := httptest.NewRecorder()
+			c, _ := gin.CreateTestContext(w)
+			c.Request = httptest.NewRequest(http.MethodPost, "/admin/uploads/session/"+id.Hex()+"/confirm", nil)
+			_, ok := claimUploadSession(c, bson.M{"_id": id})
+
+			if ok != tt.wantOK || w.Code != tt.wantStatus {
+				mt.Errorf("claim = %v with status %d, want %v with %d: %s", ok, w.Code, tt.wantOK, tt.wantStatus, w.Body.String())
+			}
+			var calls []string
+			for event := mt.GetStartedEvent(); event != nil; event = mt.GetStartedEvent() {
+				calls = append(calls, event.CommandName)
+			}
+			if len(calls) != len(tt.wantCalls) {
+				mt.Fatalf("commands = %v, want %v", calls, tt.wantCalls)
+			}
+			for i := range calls {
+				if calls[i] != tt.wantCalls[i] {
+					mt.Errorf("commands = %v, want %v", calls, tt.wantCalls)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,80 @@
+package main
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"io"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/gin-gonic/gin"
+)
+
+// maxSignedBodyBytes caps the body read into memory to verify a request signature
+const maxSignedBodyBytes = 1 << 20
+
+var (
+	// hmacSecret is the shared secret, from HMAC_SECRET, used to verify signed requests
+	hmacSecret []byte
+	// hmacMaxSkew is how far X-Timestamp may be from the server clock, from HMAC_MAX_SKEW
+	hmacMaxSkew time.Duration
+)
+
+// requestSignature returns the hex HMAC-SHA256 of "<timestamp>.<body>" under secret
+func requestSignature(secret []byte, timestamp string, body []byte) string {
+	mac := hmac.New(sha256.New, secret)
+	mac.Write([]byte(timestamp))
+	mac.Write([]byte("."))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// requireSignature rejects requests without a valid X-Signature over the X-Timestamp
+// and body, or whose timestamp is outside hmacMaxSkew. When HMAC_SECRET is unset every
+// request is rejected.
+func requireSignature() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		if len(hmacSecret) == 0 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnauthorized, codeUnauthorized, "Request signing is not configured")
+			c.Abort()
+			return
+		}
+
+		timestamp := c.GetHeader("X-Timestamp")
+		seconds, err := strconv.ParseInt(timestamp, 10, 64)
+		if err != nil {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnauthorized, codeUnauthorized, "Missing or invalid X-Timestamp")
+			c.Abort()
+			return
+		}
+		if skew := time.Since(time.Unix(seconds, 0)); skew > hmacMaxSkew || skew < -hmacMaxSkew {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnauthorized, codeUnauthorized, "Request timestamp is outside the allowed skew")
+			c.Abort()
+			return
+		}
+
+		body, err := io.ReadAll(io.LimitReader(c.Request.Body, maxSignedBodyBytes+1))
+		if err != nil || len(body) > maxSignedBodyBytes {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusRequestEntityTooLarge, codeFileTooLarge, "Signed request body is too large")
+			c.Abort()
+			return
+		}
+		c.Request.Body = io.NopCloser(bytes.NewReader(body))
+
+		expected := requestSignature(hmacSecret, timestamp, body)
+		if !hmac.Equal([]byte(expected), []byte(c.GetHeader("X-Signature"))) {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusUnauthorized, codeUnauthorized, "Invalid request signature")
+			c.Abort()
+			return
+		}
+		c.Next()
+	}
+}
@@ -0,0 +1,74 @@
+package main
+
+import (
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+// byteUnits maps size suffixes to their multiplier; units are binary, so 1MB is 1<<20 bytes
+var byteUnits = []struct {
+	suffix string
+	scale  int64
+}{
+	{"GB", 1 << 30},
+	{"MB", 1 << 20},
+	{"KB", 1 << 10},
+	{"B", 1},
+}
+
+// parseByteSize parses a size such as "512KB", "5MB" or "1048576"
+func parseByteSize(value string) (int64, error) {
+	value = strings.ToUpper(strings.TrimSpace(value))
+	scale := int64(1)
+	for _, unit := range byteUnits {
+		if strings.HasSuffix(value, unit.suffix) {
+			value, scale = strings.TrimSpace(strings.TrimSuffix(value, unit.suffix)), unit.scale
+			break
+		}
+	}
+	n, err := strconv.ParseInt(value, 10, 64)
+	if err != nil || n <= 0 {
+		return 0, fmt.Errorf("invalid size %q", value)
+	}
+	return n * scale, nil
+}
+
+// parseTypeSizeLimits parses TYPE_SIZE_LIMITS, a comma-separated list of type:size pairs
+func parseTypeSizeLimits(value string) (map[string]int64, error) {
+	limits := map[string]int64{}
+	for _, entry := range parseList(value) {
+		contentType, size, ok := strings.Cut(entry, ":")
+		if !ok || contentType == "" {
+			return nil, fmt.Errorf("entry %q must be in type:size form", entry)
+		}
+		limit, err := parseByteSize(size)
+		if err != nil {
+			return nil, fmt.Errorf("entry %q: %v", entry, err)
+		}
+		limits[strings.ToLower(contentType)] = limit
+	}
+	return limits, nil
+}
+
+// sizeLimitFor returns the size limit for a detected content type, falling back to
+// MAX_UPLOAD_BYTES for unlisted types. 0 means unlimited.
+func sizeLimitFor(contentType string) int64 {
+	if limit, ok := typeSizeLimits[mediaType(contentType)]; ok {
+		return limit
+	}
+	return maxUploadBytes
+}
+
+// uploadCeiling returns the largest size any upload may have, used to cap request bodies
+// before the content type is known. 0 means unlimited.
+func uploadCeiling() int64 {
+	if maxUploadBytes <= 0 {
+		return 0
+	}
+	ceiling := maxUploadBytes
+	for _, limit := range typeSizeLimits {
+		ceiling = max(ceiling, limit)
+	}
+	return ceiling
+}
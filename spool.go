@@ -0,0 +1,247 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"log"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+const (
+	// statusPendingUpload marks a post whose file is spooled locally, waiting for S3 to recover
+	statusPendingUpload = "pending_upload"
+	// statusUploadFailed marks a pending post whose spooled file was lost, so it cannot be uploaded
+	statusUploadFailed = "upload_failed"
+	// spoolBatchSize caps how many pending posts one retry pass uploads per collection
+	spoolBatchSize = 100
+	// spoolOrphanAge is how old a spooled file with no post must be before it is removed,
+	// leaving time for the post of an upload being spooled right now to be saved
+	spoolOrphanAge = 10 * time.Minute
+)
+
+// isTransientS3Error reports whether an S3 failure is worth retrying later: throttling,
+// 5xx responses and network errors, but not rejections or cancelled requests
+func isTransientS3Error(err error) bool {
+	if isThrottleError(err) || request.IsErrorRetryable(err) {
+		return true
+	}
+	for err != nil {
+		if rerr, ok := err.(awserr.RequestFailure); ok && rerr.StatusCode() >= 500 {
+			return true
+		}
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return false
+		}
+		// s3manager wraps part failures, so check the original error too
+		err = aerr.OrigErr()
+	}
+	return false
+}
+
+// spoolPath returns where the spooled file for an object key is kept
+func spoolPath(key string) string {
+	sum := sha256.Sum256([]byte(key))
+	return filepath.Join(spoolDir, hex.EncodeToString(sum[:]))
+}
+
+// spoolUpload writes a file that could not be uploaded to the spool directory. The file is
+// renamed into place once complete, so the retry worker never reads a partial copy.
+func spoolUpload(key string, body io.ReadSeeker) error {
+	if _, err := body.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(spoolDir, "spool-*")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(tmp.Name())
+	if _, err := io.Copy(tmp, body); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+	return os.Rename(tmp.Name(), spoolPath(key))
+}
+
+// removeSpooled deletes a spooled file, logging failures other than it being gone already
+func removeSpooled(key string) {
+	if err := os.Remove(spoolPath(key)); err != nil && !errors.Is(err, os.ErrNotExist) {
+		log.Printf("Error removing spooled file for %s: %v", key, err)
+	}
+}
+
+// spoolRetryDone waits for retrySpooledUploads to return on shutdown, so it cannot queue
+// thumbnails once the thumbnail queue is closed
+var spoolRetryDone sync.WaitGroup
+
+// startSpoolRetries runs retrySpooledUploads in the background until ctx is cancelled
+func startSpoolRetries(ctx context.Context, interval time.Duration) {
+	spoolRetryDone.Add(1)
+	go func() {
+		defer spoolRetryDone.Done()
+		retrySpooledUploads(ctx, interval)
+	}()
+}
+
+// retrySpooledUploads uploads spooled files to S3 every interval until ctx is cancelled, and
+// removes spooled files whose post is gone. A pass that has started is finished rather than
+// cancelled, since a cancelled upload would be taken for a permanent failure.
+func retrySpooledUploads(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+		if err := forEachPostsCollection(context.Background(), uploadSpooledPosts); err != nil {
+			log.Printf("Error retrying spooled uploads: %v", err)
+		}
+		if err := sweepSpool(context.Background()); err != nil {
+			log.Printf("Error sweeping spooled uploads: %v", err)
+		}
+	}
+}
+
+// sweepSpool removes spooled files that no pending or failed post references any more, such
+// as those of posts removed by DOCUMENT_TTL_DAYS or expires_in_days
+func sweepSpool(ctx context.Context) error {
+	referenced := map[string]bool{}
+	err := forEachPostsCollection(ctx, func(ctx context.Context) error {
+		filter := bson.M{"status": bson.M{"$in": bson.A{statusPendingUpload, statusUploadFailed}}}
+		opts := options.Find().SetProjection(bson.M{"object_key": 1, "picture": 1})
+		cursor, err := postsCollectionFor(ctx).Find(ctx, filter, opts)
+		if err != nil {
+			return err
+		}
+		defer cursor.Close(ctx)
+		for cursor.Next(ctx) {
+			var doc postDocument
+			if err := cursor.Decode(&doc); err != nil {
+				return err
+			}
+			referenced[spoolPath(objectKeyFor(doc))] = true
+		}
+		return cursor.Err()
+	})
+	if err != nil {
+		return err
+	}
+
+	entries, err := os.ReadDir(spoolDir)
+	if err != nil {
+		return err
+	}
+	for _, entry := range entries {
+		path := filepath.Join(spoolDir, entry.Name())
+		info, err := entry.Info()
+		if err != nil || entry.IsDir() || referenced[path] || time.Since(info.ModTime()) < spoolOrphanAge {
+			continue
+		}
+		if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+			log.Printf("Error removing orphaned spooled file %s: %v", entry.Name(), err)
+			continue
+		}
+		log.Printf("Removed orphaned spooled file %s", entry.Name())
+	}
+	return nil
+}
+
+// uploadSpooledPosts retries the pending posts of one collection, oldest first, stopping at
+// the first transient failure since S3 is most likely still down
+func uploadSpooledPosts(ctx context.Context) error {
+	collection := postsCollectionFor(ctx)
+	opts := options.Find().SetSort(bson.D{{Key: "created_at", Value: 1}}).SetLimit(spoolBatchSize)
+	cursor, err := collection.Find(ctx, bson.M{"status": statusPendingUpload}, opts)
+	if err != nil {
+		return err
+	}
+	var pending []postDocument
+	if err := cursor.All(ctx, &pending); err != nil {
+		return err
+	}
+
+	for _, doc := range pending {
+		key := objectKeyFor(doc)
+		data, err := os.ReadFile(spoolPath(key))
+		if errors.Is(err, os.ErrNotExist) {
+			log.Printf("Spooled file for post %s is missing, marking it %s", doc.ID.Hex(), statusUploadFailed)
+			_, err = collection.UpdateOne(ctx, bson.M{"_id": doc.ID, "status": statusPendingUpload}, markModified(bson.M{"$set": bson.M{"status": statusUploadFailed}}))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+		if err != nil {
+			return err
+		}
+
+		var putOptions []PutOption
+		if doc.ExpiresAt != nil {
+			putOptions = append(putOptions, withTags(lifecycleTag))
+		}
+		if contentAddressedKeys {
+			putOptions = append(putOptions, withContentAddressed())
+		}
+		if _, err := storage.Put(ctx, key, bytes.NewReader(data), doc.ContentType, putOptions...); err != nil {
+			if isTransientS3Error(err) {
+				log.Printf("S3 is still failing, %s stays spooled: %v", key, err)
+				return nil
+			}
+			// The spooled file is kept for manual recovery
+			log.Printf("Error uploading spooled file %s to S3, marking post %s %s: %v", key, doc.ID.Hex(), statusUploadFailed, err)
+			_, err = collection.UpdateOne(ctx, bson.M{"_id": doc.ID, "status": statusPendingUpload}, markModified(bson.M{"$set": bson.M{"status": statusUploadFailed}}))
+			if err != nil {
+				return err
+			}
+			continue
+		}
+
+		// Every pending post of a content-addressed key shares the one spooled file
+		result, err := collection.UpdateMany(ctx,
+			bson.M{"object_key": key, "status": statusPendingUpload},
+			markModified(bson.M{"$unset": bson.M{"status": ""}, "$set": bson.M{"uploaded_at": time.Now()}}))
+		if err != nil {
+			return err
+		}
+		removeSpooled(key)
+		if result.MatchedCount == 0 {
+			// The post was deleted while its file was uploading, so the object would be an orphan
+			shared, err := objectShared(ctx, key, primitive.NilObjectID)
+			if err != nil {
+				return err
+			}
+			if !shared {
+				if err := storage.Delete(ctx, key); err != nil {
+					log.Printf("Error deleting object %s of deleted post %s: %v", key, doc.ID.Hex(), err)
+				}
+			}
+			continue
+		}
+		log.Printf("Uploaded spooled file for post %s", doc.ID.Hex())
+		if generateThumbnails && isDecodableImage(doc.ContentType) {
+			if err := enqueueThumbnail(collection, doc.ID, key, bytes.NewReader(data)); err != nil {
+				log.Printf("Error queueing thumbnail for %s: %v", key, err)
+			}
+		}
+	}
+	return nil
+}
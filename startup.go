@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"log"
+	"time"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"go.mongodb.org/mongo-driver/mongo/readpref"
+)
+
+// startupCheckTimeout bounds a single attempt of a startup dependency check
+const startupCheckTimeout = 10 * time.Second
+
+// maxStartupRetryDelay caps the doubling delay between startup attempts
+const maxStartupRetryDelay = 30 * time.Second
+
+// waitForDependency runs check until it succeeds, retrying up to retries times with a
+// delay that doubles after each failure, and returns the last error once retries run out
+func waitForDependency(name string, retries int, delay time.Duration, check func(ctx context.Context) error) error {
+	for attempt := 0; ; attempt++ {
+		ctx, cancel := context.WithTimeout(context.Background(), startupCheckTimeout)
+		err := check(ctx)
+		cancel()
+		if err == nil || attempt >= retries {
+			return err
+		}
+
+		log.Printf("%s is not ready (attempt %d of %d), retrying in %s: %v", name, attempt+1, retries+1, delay, err)
+		time.Sleep(delay)
+		delay = min(delay*2, maxStartupRetryDelay)
+	}
+}
+
+// pingMongo checks that a MongoDB primary is reachable
+func pingMongo(ctx context.Context) error {
+	return mongoClient.Ping(ctx, readpref.Primary())
+}
+
+// headBucket checks that the configured bucket exists and is accessible
+func headBucket(ctx context.Context) error {
+	_, err := s3Session.HeadBucketWithContext(ctx, &s3.HeadBucketInput{Bucket: aws.String(bucket)})
+	return err
+}
@@ -0,0 +1,478 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"io"
+	"log"
+	"net/url"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/aws/awserr"
+	"github.com/aws/aws-sdk-go/aws/request"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/aws/aws-sdk-go/service/s3/s3manager"
+)
+
+// ErrObjectExists is returned by Put when no-overwrite mode is on and the key is already taken
+var ErrObjectExists = errors.New("object already exists")
+
+// ErrTooLarge is returned by Put when the body grows past MAX_UPLOAD_BYTES mid-stream
+var ErrTooLarge = errors.New("upload exceeds the maximum size")
+
+// sizeLimitReader fails with ErrTooLarge as soon as more than remaining bytes are read
+type sizeLimitReader struct {
+	r         io.Reader
+	remaining int64
+}
+
+func (l *sizeLimitReader) Read(p []byte) (int, error) {
+	if l.remaining < 0 {
+		return 0, ErrTooLarge
+	}
+	// Read at most one byte past the limit, which is enough to detect an oversized body
+	if int64(len(p)) > l.remaining+1 {
+		p = p[:l.remaining+1]
+	}
+	n, err := l.r.Read(p)
+	l.remaining -= int64(n)
+	if l.remaining < 0 {
+		return n, ErrTooLarge
+	}
+	return n, err
+}
+
+// limitUploadSize wraps r in a sizeLimitReader when MAX_UPLOAD_BYTES is set, allowing
+// up to the largest TYPE_SIZE_LIMITS entry. A seekable body already within the limit is
+// returned as is, so s3manager can read its parts in place instead of buffering each one.
+func limitUploadSize(r io.Reader) io.Reader {
+	ceiling := uploadCeiling()
+	if ceiling <= 0 {
+		return r
+	}
+	if seeker, ok := r.(io.Seeker); ok {
+		if remaining, err := remainingLength(seeker); err == nil && remaining <= ceiling {
+			return r
+		}
+	}
+	return &sizeLimitReader{r: r, remaining: ceiling}
+}
+
+// remainingLength returns how many bytes are left after the current offset of s, leaving it
+// at that offset
+func remainingLength(s io.Seeker) (int64, error) {
+	offset, err := s.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return 0, err
+	}
+	end, err := s.Seek(0, io.SeekEnd)
+	if err != nil {
+		return 0, err
+	}
+	if _, err := s.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+	return end - offset, nil
+}
+
+// isTooLarge reports whether err, or an AWS error it wraps, is ErrTooLarge
+func isTooLarge(err error) bool {
+	for err != nil {
+		if errors.Is(err, ErrTooLarge) {
+			return true
+		}
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return false
+		}
+		err = aerr.OrigErr()
+	}
+	return false
+}
+
+// Storage stores uploaded files and returns the URL they are served from
+type Storage interface {
+	Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...PutOption) (url string, err error)
+	Get(ctx context.Context, key string) (io.ReadCloser, error)
+	Delete(ctx context.Context, key string) error
+}
+
+// putOptions holds optional per-object settings for Storage.Put
+type putOptions struct {
+	tags             map[string]string
+	overwrite        bool
+	contentAddressed bool
+}
+
+// PutOption customizes a single Storage.Put call
+type PutOption func(*putOptions)
+
+// withTags attaches object tags; backends without tagging ignore them
+func withTags(tags map[string]string) PutOption {
+	return func(o *putOptions) {
+		if o.tags == nil {
+			o.tags = map[string]string{}
+		}
+		for key, value := range tags {
+			o.tags[key] = value
+		}
+	}
+}
+
+// withOverwrite lets a Put replace an existing object even in no-overwrite mode
+func withOverwrite() PutOption {
+	return func(o *putOptions) { o.overwrite = true }
+}
+
+// withContentAddressed marks the key as derived from the content's hash, so an existing
+// object under it already holds the same bytes and the upload can be skipped
+func withContentAddressed() PutOption {
+	return func(o *putOptions) { o.contentAddressed = true }
+}
+
+// applyPutOptions collects PutOptions into a putOptions value
+func applyPutOptions(opts []PutOption) putOptions {
+	var o putOptions
+	for _, opt := range opts {
+		opt(&o)
+	}
+	return o
+}
+
+// parseTag parses a single key=value object tag, using def when value is empty
+func parseTag(value, def string) (map[string]string, error) {
+	if value == "" {
+		value = def
+	}
+	key, tagValue, ok := strings.Cut(value, "=")
+	if !ok || key == "" {
+		return nil, errors.New("tag must be in key=value form")
+	}
+	return map[string]string{key: tagValue}, nil
+}
+
+// s3Storage stores files in the configured S3 bucket
+type s3Storage struct {
+	uploader *s3manager.Uploader
+}
+
+// newS3Storage returns a Storage backed by the shared S3 session
+func newS3Storage() *s3Storage {
+	return &s3Storage{uploader: s3manager.NewUploaderWithClient(s3Session)}
+}
+
+// Put uploads a file to S3
+func (s *s3Storage) Put(ctx context.Context, key string, r io.Reader, contentType string, opts ...PutOption) (string, error) {
+	return s.uploadToS3(ctx, r, key, contentType, applyPutOptions(opts))
+}
+
+// uploadToS3 uploads a file to AWS S3 and returns the file's URL
+func (s *s3Storage) uploadToS3(ctx context.Context, file io.Reader, fileName string, contentType string, o putOptions) (string, error) {
+	if o.contentAddressed {
+		exists, err := s3ObjectExists(ctx, fileName)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			log.Printf("Content-addressed object %s already exists, skipping upload", fileName)
+			return s3URLPrefix() + fileName, nil
+		}
+		log.Printf("Content-addressed object %s not found, uploading", fileName)
+	} else if noOverwrite && !o.overwrite && (!conditionalWrites || safeUpload) {
+		exists, err := s3ObjectExists(ctx, fileName)
+		if err != nil {
+			return "", err
+		}
+		if exists {
+			return "", ErrObjectExists
+		}
+	}
+
+	// With SAFE_UPLOAD the body goes to a temp key first, so the real key is never half-written
+	uploadKey := fileName
+	if safeUpload {
+		uploadKey = tempUploadPrefix + fileName
+	}
+
+	// A body that outgrows the limit fails the upload, and s3manager aborts any multipart upload
+	input := &s3manager.UploadInput{
+		Bucket:      aws.String(bucket),
+		Key:         aws.String(uploadKey),
+		Body:        limitUploadSize(file),
+		ContentType: aws.String(contentType),
+	}
+	if s3GrantRead != "" {
+		input.GrantRead = aws.String(s3GrantRead)
+	} else {
+		input.ACL = aws.String("public-read")
+	}
+	if len(o.tags) > 0 {
+		tags := url.Values{}
+		for key, value := range o.tags {
+			tags.Set(key, value)
+		}
+		input.Tagging = aws.String(tags.Encode())
+	}
+
+	var uploadOpts []func(*s3manager.Uploader)
+	if noOverwrite && !o.overwrite && !o.contentAddressed && conditionalWrites && !safeUpload {
+		uploadOpts = append(uploadOpts, func(u *s3manager.Uploader) {
+			u.RequestOptions = append(u.RequestOptions, ifNoneMatchAny)
+		})
+	}
+	_, err := s.uploader.UploadWithContext(ctx, input, uploadOpts...)
+	if isPreconditionFailed(err) {
+		return "", ErrObjectExists
+	}
+	if err != nil {
+		if safeUpload {
+			removeTempObject(ctx, uploadKey)
+		}
+		return "", err
+	}
+	if safeUpload {
+		err := promoteTempObject(ctx, uploadKey, fileName)
+		removeTempObject(ctx, uploadKey)
+		if err != nil {
+			return "", err
+		}
+	}
+
+	fileURL := s3URLPrefix() + fileName
+	return fileURL, nil
+}
+
+// ifNoneMatchAny makes the request that creates the object fail with 412 when the key already
+// exists, so no-overwrite mode needs no HEAD beforehand and cannot race another writer.
+// Only PutObject and CompleteMultipartUpload accept the precondition.
+func ifNoneMatchAny(r *request.Request) {
+	if name := r.Operation.Name; name == "PutObject" || name == "CompleteMultipartUpload" {
+		r.HTTPRequest.Header.Set("If-None-Match", "*")
+	}
+}
+
+// isPreconditionFailed reports whether err, or an AWS error it wraps, is a failed If-None-Match
+func isPreconditionFailed(err error) bool {
+	for err != nil {
+		if rerr, ok := err.(awserr.RequestFailure); ok && rerr.StatusCode() == 412 {
+			return true
+		}
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return false
+		}
+		if aerr.Code() == "PreconditionFailed" {
+			return true
+		}
+		err = aerr.OrigErr()
+	}
+	return false
+}
+
+// tempUploadPrefix is where SAFE_UPLOAD stages objects before copying them to their real key
+const tempUploadPrefix = "tmp/"
+
+// promoteTempObject copies a staged upload to its final key. Content type and tags are
+// copied along with the object, but the ACL is not, so the read grant is applied again.
+func promoteTempObject(ctx context.Context, tempKey, key string) error {
+	input := &s3.CopyObjectInput{
+		Bucket:     aws.String(bucket),
+		Key:        aws.String(key),
+		CopySource: aws.String(url.PathEscape(bucket + "/" + tempKey)),
+	}
+	if s3GrantRead != "" {
+		input.GrantRead = aws.String(s3GrantRead)
+	} else {
+		input.ACL = aws.String("public-read")
+	}
+	_, err := s3Session.CopyObjectWithContext(ctx, input)
+	return err
+}
+
+// removeTempObject deletes a staged upload, even when the request was cancelled. Failures
+// are only logged; a lifecycle rule on tmp/ catches anything left behind.
+func removeTempObject(ctx context.Context, tempKey string) {
+	_, err := s3Session.DeleteObjectWithContext(context.WithoutCancel(ctx), &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(tempKey),
+	})
+	if err != nil {
+		log.Printf("Error removing temp upload %s: %v", tempKey, err)
+	}
+}
+
+// Get opens an object in S3 for reading
+func (s *s3Storage) Get(ctx context.Context, key string) (io.ReadCloser, error) {
+	object, err := s3Session.GetObjectWithContext(ctx, &s3.GetObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if err != nil {
+		return nil, err
+	}
+	return object.Body, nil
+}
+
+// Delete removes an object from S3
+func (s *s3Storage) Delete(ctx context.Context, key string) error {
+	_, err := s3Session.DeleteObjectWithContext(ctx, &s3.DeleteObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	return err
+}
+
+// s3ObjectExists reports whether an object exists in the bucket using HeadObject
+func s3ObjectExists(ctx context.Context, key string) (bool, error) {
+	_, err := s3Session.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(key),
+	})
+	if isNotFound(err) {
+		return false, nil
+	}
+	return err == nil, err
+}
+
+// isNotFound reports whether an S3 error means the object does not exist.
+// HeadObject has no body, so a missing key surfaces as a bare NotFound code.
+func isNotFound(err error) bool {
+	aerr, ok := err.(awserr.Error)
+	return ok && (aerr.Code() == "NotFound" || aerr.Code() == s3.ErrCodeNoSuchKey)
+}
+
+// checkBucketRegion compares the bucket's actual region with the configured one.
+// It returns the bucket region and whether it matches.
+func checkBucketRegion(ctx context.Context, configured string) (string, bool, error) {
+	output, err := s3Session.GetBucketLocationWithContext(ctx, &s3.GetBucketLocationInput{Bucket: aws.String(bucket)})
+	if err != nil {
+		return "", false, err
+	}
+	// GetBucketLocation reports us-east-1 as an empty constraint and eu-west-1 as "EU"
+	region := s3.NormalizeBucketLocation(aws.StringValue(output.LocationConstraint))
+	return region, region == configured, nil
+}
+
+// grantPattern matches one S3 grantee such as id="<canonical-user-id>" or uri="<group-uri>"
+var grantPattern = regexp.MustCompile(`^(id|emailAddress|uri)=("[^",]+"|[^",]+)$`)
+
+// validGrant reports whether value is a comma-separated list of S3 grantees
+func validGrant(value string) bool {
+	for _, grantee := range strings.Split(value, ",") {
+		if !grantPattern.MatchString(strings.TrimSpace(grantee)) {
+			return false
+		}
+	}
+	return true
+}
+
+// s3URLPrefix returns the public URL prefix of objects in the bucket
+func s3URLPrefix() string {
+	return "https://" + bucket + ".s3.amazonaws.com/"
+}
+
+// s3ThrottleCodes are S3 error codes that mean the request should be retried later
+var s3ThrottleCodes = []string{"SlowDown", "ServiceUnavailable", "TooManyRequests"}
+
+// isThrottleError reports whether err, or an AWS error it wraps, indicates S3 throttling
+func isThrottleError(err error) bool {
+	for err != nil {
+		if rerr, ok := err.(awserr.RequestFailure); ok {
+			if code := rerr.StatusCode(); code == 503 || code == 429 {
+				return true
+			}
+		}
+		aerr, ok := err.(awserr.Error)
+		if !ok {
+			return false
+		}
+		if containsString(s3ThrottleCodes, aerr.Code()) || request.IsErrorThrottle(aerr) {
+			return true
+		}
+		// s3manager wraps part failures, so check the original error too
+		err = aerr.OrigErr()
+	}
+	return false
+}
+
+// localStorage stores files on the local filesystem, served as static files under baseURL
+type localStorage struct {
+	dir     string
+	baseURL string
+}
+
+// path resolves a key to a file path, refusing keys that escape the storage directory
+func (s *localStorage) path(key string) (string, error) {
+	path := filepath.Join(s.dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(path, filepath.Clean(s.dir)+string(filepath.Separator)) {
+		return "", errors.New("invalid storage key")
+	}
+	return path, nil
+}
+
+// Put writes a file below the storage directory
+func (s *localStorage) Put(_ context.Context, key string, r io.Reader, _ string, opts ...PutOption) (string, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return "", err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0o755); err != nil {
+		return "", err
+	}
+
+	o := applyPutOptions(opts)
+	url := strings.TrimSuffix(s.baseURL, "/") + "/" + key
+	if o.contentAddressed {
+		if _, err := os.Stat(path); err == nil {
+			log.Printf("Content-addressed file %s already exists, skipping write", key)
+			return url, nil
+		}
+		log.Printf("Content-addressed file %s not found, writing", key)
+	}
+
+	flags := os.O_WRONLY | os.O_CREATE | os.O_TRUNC
+	if noOverwrite && !o.overwrite && !o.contentAddressed {
+		flags |= os.O_EXCL
+	}
+	out, err := os.OpenFile(path, flags, 0o644)
+	if errors.Is(err, os.ErrExist) {
+		return "", ErrObjectExists
+	}
+	if err != nil {
+		return "", err
+	}
+	if _, err := io.Copy(out, limitUploadSize(r)); err != nil {
+		out.Close()
+		os.Remove(path)
+		return "", err
+	}
+	if err := out.Close(); err != nil {
+		return "", err
+	}
+	return url, nil
+}
+
+// Get opens a file in the storage directory for reading
+func (s *localStorage) Get(_ context.Context, key string) (io.ReadCloser, error) {
+	path, err := s.path(key)
+	if err != nil {
+		return nil, err
+	}
+	return os.Open(path)
+}
+
+// Delete removes a file from the storage directory; missing files are not an error
+func (s *localStorage) Delete(_ context.Context, key string) error {
+	path, err := s.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(path); err != nil && !errors.Is(err, os.ErrNotExist) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package main
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// streamFlushEvery is how many posts are written between flushes of a streamed response
+const streamFlushEvery = 50
+
+// streamErrorTrailer is the HTTP trailer set when a streamed response ends early
+const streamErrorTrailer = "X-Stream-Error"
+
+// streamPostsJSON writes the cursor's posts as a JSON array one document at a time, so
+// memory stays flat however large the collection is. Once "[" is sent the status cannot
+// change, so a failure mid-stream leaves the array unclosed, followed by an error object on
+// its own line and the X-Stream-Error trailer; clients cannot mistake it for a full result.
+func streamPostsJSON(c *gin.Context, cursor *mongo.Cursor, fields []string) {
+	ctx := c.Request.Context()
+	c.Header("Content-Type", "application/json; charset=utf-8")
+	c.Header("Trailer", streamErrorTrailer)
+	c.Status(http.StatusOK)
+
+	w := c.Writer
+	encoder := json.NewEncoder(w)
+	w.WriteString("[")
+	count := 0
+	failed := false
+	for cursor.Next(ctx) {
+		var doc postDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Error decoding post while streaming after %d posts: %v", count, err)
+			recordError(c, errorCategoryMongo)
+			failed = true
+			break
+		}
+		if count > 0 {
+			w.WriteString(",")
+		}
+		var item any = toPostResponse(doc)
+		if fields != nil {
+			selected, err := selectFields(toPostResponse(doc), fields)
+			if err != nil {
+				log.Printf("Error selecting post fields while streaming: %v", err)
+				failed = true
+				break
+			}
+			item = selected
+		}
+		if err := encoder.Encode(item); err != nil {
+			log.Printf("Error writing streamed post, client likely disconnected: %v", err)
+			return
+		}
+		count++
+		if count%streamFlushEvery == 0 {
+			w.Flush()
+		}
+	}
+	if err := cursor.Err(); err != nil && ctx.Err() == nil {
+		log.Printf("Error reading posts while streaming after %d posts: %v", count, err)
+		recordError(c, errorCategoryMongo)
+		failed = true
+	}
+	if failed {
+		message := fmt.Sprintf("Stream ended early after %d posts", count)
+		marker, _ := json.Marshal(gin.H{"error": message, "code": codeMongoFailure})
+		w.WriteString("\n")
+		w.Write(marker)
+		w.WriteString("\n")
+		w.Header().Set(streamErrorTrailer, message)
+		w.Flush()
+		return
+	}
+	w.WriteString("]\n")
+	w.Flush()
+}
+
+// streamPosts runs the post query and streams the results with streamPostsJSON
+func streamPosts(c *gin.Context, collection *mongo.Collection, filter interface{}, opts *options.FindOptions, fields []string) {
+	cursor, err := collection.Find(c.Request.Context(), filter, opts)
+	if err != nil {
+		log.Printf("Error fetching data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+	streamPostsJSON(c, cursor, fields)
+}
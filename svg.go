@@ -0,0 +1,136 @@
+package main
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"io"
+	"strings"
+)
+
+// errUnsafeSVG is returned when an SVG contains scripts or event handlers and cannot be uploaded as-is
+var errUnsafeSVG = errors.New("svg contains scripts or event handlers")
+
+// svgUnsafeElements are removed entirely, including their children, when stripping
+var svgUnsafeElements = []string{"script", "foreignobject"}
+
+// looksLikeSVG reports whether a file should be treated as an SVG document
+func looksLikeSVG(filename, contentType string, file io.ReadSeeker) (bool, error) {
+	if fileExtension(filename) == ".svg" {
+		return true, nil
+	}
+	switch mediaType(contentType) {
+	case "text/xml", "text/plain", "image/svg+xml":
+	default:
+		return false, nil
+	}
+
+	head := make([]byte, 1024)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return false, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return false, err
+	}
+	return bytes.Contains(bytes.ToLower(head[:n]), []byte("<svg")), nil
+}
+
+// sanitizeSVG checks an SVG for scripts and event handler attributes. With strip
+// set they are removed and the cleaned document is returned; otherwise errUnsafeSVG is returned.
+func sanitizeSVG(file io.Reader, strip bool) (*bytes.Reader, error) {
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return nil, err
+	}
+
+	var out bytes.Buffer
+	decoder := xml.NewDecoder(bytes.NewReader(data))
+	encoder := xml.NewEncoder(&out)
+	unsafe := false
+	skipDepth := 0
+
+	for {
+		// RawToken keeps namespace prefixes as written so they survive re-encoding
+		token, err := decoder.RawToken()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, err
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			if skipDepth > 0 {
+				skipDepth++
+				continue
+			}
+			if containsString(svgUnsafeElements, strings.ToLower(t.Name.Local)) {
+				unsafe = true
+				skipDepth = 1
+				continue
+			}
+			clean := t.Copy()
+			clean.Name = flattenName(t.Name)
+			clean.Attr = clean.Attr[:0]
+			for _, attr := range t.Attr {
+				if unsafeSVGAttr(attr) {
+					unsafe = true
+					continue
+				}
+				clean.Attr = append(clean.Attr, xml.Attr{Name: flattenName(attr.Name), Value: attr.Value})
+			}
+			token = clean
+		case xml.EndElement:
+			if skipDepth > 0 {
+				skipDepth--
+				continue
+			}
+			token = xml.EndElement{Name: flattenName(t.Name)}
+		case xml.Directive:
+			// Drop DOCTYPE declarations, which can define entities
+			continue
+		default:
+			if skipDepth > 0 {
+				continue
+			}
+		}
+
+		if err := encoder.EncodeToken(token); err != nil {
+			return nil, err
+		}
+	}
+	if err := encoder.Flush(); err != nil {
+		return nil, err
+	}
+
+	if !unsafe {
+		return bytes.NewReader(data), nil
+	}
+	if !strip {
+		return nil, errUnsafeSVG
+	}
+	return bytes.NewReader(out.Bytes()), nil
+}
+
+// unsafeSVGAttr reports whether an attribute is an event handler or a javascript: link
+func unsafeSVGAttr(attr xml.Attr) bool {
+	name := strings.ToLower(attr.Name.Local)
+	if strings.HasPrefix(name, "on") {
+		return true
+	}
+	if name == "href" {
+		value := strings.ToLower(strings.TrimSpace(attr.Value))
+		return strings.HasPrefix(value, "javascript:")
+	}
+	return false
+}
+
+// flattenName joins a raw namespace prefix back onto the local name
+func flattenName(name xml.Name) xml.Name {
+	if name.Space == "" {
+		return name
+	}
+	return xml.Name{Local: name.Space + ":" + name.Local}
+}
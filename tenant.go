@@ -0,0 +1,75 @@
+package main
+
+import (
+	"context"
+	"net/http"
+	"regexp"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// tenantHeader names the tenant a request acts for when TENANTS is set
+const tenantHeader = "X-Tenant-ID"
+
+// tenantPattern restricts tenant IDs to characters safe in collection names and S3 keys
+var tenantPattern = regexp.MustCompile(`^[a-z0-9_-]{1,64}$`)
+
+// tenantContextKey is the request context key holding the tenant ID
+type tenantContextKey struct{}
+
+// withTenant returns a context whose posts collection is the tenant's
+func withTenant(ctx context.Context, tenant string) context.Context {
+	return context.WithValue(ctx, tenantContextKey{}, tenant)
+}
+
+// tenantFromContext returns the tenant set by the tenant middleware, or "" for the default
+func tenantFromContext(ctx context.Context) string {
+	tenant, _ := ctx.Value(tenantContextKey{}).(string)
+	return tenant
+}
+
+// postsCollectionFor returns the posts collection for the request's tenant: COLLECTION_NAME
+// suffixed with _<tenant>, or COLLECTION_NAME itself when there is no tenant
+func postsCollectionFor(ctx context.Context) *mongo.Collection {
+	name := collName
+	if tenant := tenantFromContext(ctx); tenant != "" {
+		name += "_" + tenant
+	}
+	return mongoClient.Database(dbName).Collection(name)
+}
+
+// tenantMiddleware reads X-Tenant-ID and puts the tenant in the request context. Tenants
+// not on TENANTS get 403; without the header, or with TENANTS unset, the default applies.
+func tenantMiddleware() gin.HandlerFunc {
+	return func(c *gin.Context) {
+		tenant := strings.ToLower(strings.TrimSpace(c.GetHeader(tenantHeader)))
+		if tenant == "" || len(tenants) == 0 {
+			c.Next()
+			return
+		}
+		if !containsString(tenants, tenant) {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusForbidden, codeForbidden, "Unknown tenant")
+			c.Abort()
+			return
+		}
+		c.Request = c.Request.WithContext(withTenant(c.Request.Context(), tenant))
+		c.Next()
+	}
+}
+
+// forEachPostsCollection runs fn with a context for the default posts collection and then
+// one for each tenant, so startup index creation covers every collection
+func forEachPostsCollection(ctx context.Context, fn func(context.Context) error) error {
+	if err := fn(ctx); err != nil {
+		return err
+	}
+	for _, tenant := range tenants {
+		if err := fn(withTenant(ctx, tenant)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
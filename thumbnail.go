@@ -0,0 +1,120 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"image/jpeg"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/disintegration/imaging"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// thumbnailKey returns the S3 key used for the thumbnail of an uploaded file
+func thumbnailKey(fileName string) string {
+	// Tenant thumbnails stay under the tenant's prefix
+	prefix, rest := splitTenantKey(fileName)
+	return prefix + "thumbnails/" + strings.TrimSuffix(rest, filepath.Ext(rest)) + ".jpg"
+}
+
+// createThumbnail generates a downscaled JPEG of an image, uploads it and returns its URL
+func createThumbnail(ctx context.Context, file io.ReadSeeker, fileName string) (string, error) {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return "", err
+	}
+	img, err := imaging.Decode(file)
+	if err != nil {
+		return "", err
+	}
+
+	thumb := imaging.Fit(img, thumbnailSize, thumbnailSize, imaging.Lanczos)
+	var buf bytes.Buffer
+	if err := jpeg.Encode(&buf, thumb, &jpeg.Options{Quality: 85}); err != nil {
+		return "", err
+	}
+	return storage.Put(ctx, thumbnailKey(fileName), bytes.NewReader(buf.Bytes()), "image/jpeg")
+}
+
+// thumbnailJobTimeout bounds generating, uploading and recording one thumbnail
+const thumbnailJobTimeout = time.Minute
+
+// thumbnailJob is a queued request to generate the thumbnail of an uploaded post
+type thumbnailJob struct {
+	collection *mongo.Collection
+	postID     primitive.ObjectID
+	key        string
+	data       []byte
+}
+
+var (
+	// thumbnailJobs feeds the thumbnail workers started by startThumbnailWorkers
+	thumbnailJobs chan thumbnailJob
+	// thumbnailWorkersDone waits for the workers to drain the queue on shutdown
+	thumbnailWorkersDone sync.WaitGroup
+)
+
+// errThumbnailQueueFull is returned when no thumbnail job can be queued without blocking
+var errThumbnailQueueFull = errors.New("thumbnail queue is full")
+
+// startThumbnailWorkers starts n goroutines generating thumbnails from a queue of queueSize jobs
+func startThumbnailWorkers(n, queueSize int) {
+	thumbnailJobs = make(chan thumbnailJob, queueSize)
+	for i := 0; i < n; i++ {
+		thumbnailWorkersDone.Add(1)
+		go func() {
+			defer thumbnailWorkersDone.Done()
+			for job := range thumbnailJobs {
+				runThumbnailJob(job)
+			}
+		}()
+	}
+}
+
+// stopThumbnailWorkers closes the queue and waits for queued jobs to finish
+func stopThumbnailWorkers() {
+	close(thumbnailJobs)
+	thumbnailWorkersDone.Wait()
+}
+
+// enqueueThumbnail copies an uploaded image and queues its thumbnail for a worker.
+// The copy is needed because the upload's temporary file is removed after the request.
+func enqueueThumbnail(collection *mongo.Collection, postID primitive.ObjectID, key string, file io.ReadSeeker) error {
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+	data, err := io.ReadAll(file)
+	if err != nil {
+		return err
+	}
+	select {
+	case thumbnailJobs <- thumbnailJob{collection: collection, postID: postID, key: key, data: data}:
+		return nil
+	default:
+		return errThumbnailQueueFull
+	}
+}
+
+// runThumbnailJob generates and uploads a thumbnail, then records its URL on the post in the
+// collection it was queued from, since the job's context carries no tenant
+func runThumbnailJob(job thumbnailJob) {
+	ctx, cancel := context.WithTimeout(context.Background(), thumbnailJobTimeout)
+	defer cancel()
+
+	thumbnailURL, err := createThumbnail(ctx, bytes.NewReader(job.data), job.key)
+	if err != nil {
+		log.Printf("Error creating thumbnail for %s: %v", job.key, err)
+		return
+	}
+	_, err = job.collection.UpdateOne(ctx, bson.M{"_id": job.postID}, markModified(bson.M{"$set": bson.M{"thumbnail_url": thumbnailURL}}))
+	if err != nil {
+		log.Printf("Error saving thumbnail URL for post %s: %v", job.postID.Hex(), err)
+	}
+}
@@ -0,0 +1,54 @@
+package main
+
+import (
+	"bytes"
+	"image"
+	"image/png"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo/integration/mtest"
+)
+
+func TestRunThumbnailJobUpdatesQueuedCollection(t *testing.T) {
+	previousStorage, previousSize := storage, thumbnailSize
+	storage, thumbnailSize = &localStorage{dir: t.TempDir(), baseURL: "http://localhost/files"}, 32
+	defer func() { storage, thumbnailSize = previousStorage, previousSize }()
+
+	var picture bytes.Buffer
+	if err := png.Encode(&picture, image.NewGray(image.Rect(0, 0, 64, 64))); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name       string
+		collection string
+		key        string
+	}{
+		{"default collection", "posts", "photo.png"},
+		{"tenant collection", "posts_acme", "tenants/acme/photo.png"},
+	}
+	mt := mtest.New(t, mtest.NewOptions().ClientType(mtest.Mock))
+	for _, tt := range tests {
+		mt.Run(tt.name, func(mt *mtest.T) {
+			useMockMongo(mt)
+			mt.AddMockResponses(mtest.CreateSuccessResponse(bson.E{Key: "n", Value: 1}, bson.E{Key: "nModified", Value: 1}))
+
+			runThumbnailJob(thumbnailJob{
+				collection: mongoClient.Database(dbName).Collection(tt.collection),
+				postID:     primitive.NewObjectID(),
+				key:        tt.key,
+				data:       picture.Bytes(),
+			})
+
+			event := mt.GetStartedEvent()
+			if event == nil || event.CommandName != "update" {
+				mt.Fatalf("no update was sent")
+			}
+			if got := event.Command.Lookup("update").StringValue(); got != tt.collection {
+				mt.Errorf("updated collection %q, want %q", got, tt.collection)
+			}
+		})
+	}
+}
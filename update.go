@@ -0,0 +1,142 @@
+package main
+
+import (
+	"errors"
+	"log"
+	"net/http"
+	"time"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+	"go.mongodb.org/mongo-driver/mongo/options"
+)
+
+// replacePostRequest is the body of PUT /admin/posts/:id; every editable field is replaced
+type replacePostRequest struct {
+	Name     string                 `json:"name"`
+	Email    string                 `json:"email"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// patchPostRequest is the body of PATCH /admin/posts/:id; only fields present are changed
+type patchPostRequest struct {
+	Name     *string                `json:"name"`
+	Email    *string                `json:"email"`
+	Metadata map[string]interface{} `json:"metadata"`
+}
+
+// replacePost handles PUT requests that replace a post's editable fields.
+// Fields missing from the body are reset to empty, unlike patchPost.
+func replacePost(c *gin.Context) {
+	var req replacePostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	update, err := replaceUpdate(req)
+	if err != nil {
+		log.Printf("Error encrypting email: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to update data in MongoDB")
+		return
+	}
+	applyPostUpdate(c, update)
+}
+
+// replaceUpdate builds the update for a PUT body, clearing every editable field it omits
+func replaceUpdate(req replacePostRequest) (bson.M, error) {
+	set, err := emailFields(req.Email)
+	if err != nil {
+		return nil, err
+	}
+	unset := staleEmailFields(set)
+	set["name"] = req.Name
+	set["updated_at"] = time.Now()
+	update := bson.M{"$set": set, "$unset": unset}
+	if req.Metadata != nil {
+		set["metadata"] = req.Metadata
+	} else {
+		unset["metadata"] = ""
+	}
+	if len(unset) == 0 {
+		delete(update, "$unset")
+	}
+	return update, nil
+}
+
+// patchPost handles PATCH requests that update only the fields present in the body,
+// leaving every other field as it was
+func patchPost(c *gin.Context) {
+	var req patchPostRequest
+	if err := c.ShouldBindJSON(&req); err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid request body")
+		return
+	}
+
+	update, err := patchUpdate(req)
+	if err != nil {
+		log.Printf("Error encrypting email: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to update data in MongoDB")
+		return
+	}
+	applyPostUpdate(c, update)
+}
+
+// patchUpdate builds the update for a PATCH body, touching only the fields it contains
+func patchUpdate(req patchPostRequest) (bson.M, error) {
+	set := bson.M{"updated_at": time.Now()}
+	update := bson.M{"$set": set}
+	if req.Name != nil {
+		set["name"] = *req.Name
+	}
+	if req.Email != nil {
+		email, err := emailFields(*req.Email)
+		if err != nil {
+			return nil, err
+		}
+		for field, value := range email {
+			set[field] = value
+		}
+		if unset := staleEmailFields(email); len(unset) > 0 {
+			update["$unset"] = unset
+		}
+	}
+	if req.Metadata != nil {
+		set["metadata"] = req.Metadata
+	}
+	return update, nil
+}
+
+// applyPostUpdate applies an update to the post named in the URL and responds with the updated post
+func applyPostUpdate(c *gin.Context, update bson.M) {
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid post ID")
+		return
+	}
+
+	var result postDocument
+	opts := options.FindOneAndUpdate().SetReturnDocument(options.After)
+	err = postsCollectionFor(c.Request.Context()).FindOneAndUpdate(c.Request.Context(), bson.M{"_id": id}, markModified(update), opts).Decode(&result)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error updating post in MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to update data in MongoDB")
+		return
+	}
+
+	recordAudit(c, auditActionUpdate, result.ID.Hex())
+	respond(c, http.StatusOK, toPostResponse(result), nil)
+}
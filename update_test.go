@@ -0,0 +1,89 @@
+package main
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"testing"
+
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+func TestPostUpdates(t *testing.T) {
+	tests := []struct {
+		name      string
+		method    string
+		body      string
+		wantSet   bson.M
+		wantUnset bson.M
+	}{
+		{
+			name:      "PUT clears omitted fields",
+			method:    http.MethodPut,
+			body:      `{"name": "Ada"}`,
+			wantSet:   bson.M{"name": "Ada", "email": ""},
+			wantUnset: bson.M{"metadata": "", "email_raw": "", "email_hash": ""},
+		},
+		{
+			name:      "PUT replaces every field",
+			method:    http.MethodPut,
+			body:      `{"name": "Ada", "email": "ada@example.com", "metadata": {"team": "core"}}`,
+			wantSet:   bson.M{"name": "Ada", "email": "ada@example.com", "metadata": map[string]interface{}{"team": "core"}},
+			wantUnset: bson.M{"email_raw": "", "email_hash": ""},
+		},
+		{
+			name:    "PATCH keeps omitted fields",
+			method:  http.MethodPatch,
+			body:    `{"name": "Ada"}`,
+			wantSet: bson.M{"name": "Ada"},
+		},
+		{
+			name:    "PATCH with only metadata",
+			method:  http.MethodPatch,
+			body:    `{"metadata": {"team": "core"}}`,
+			wantSet: bson.M{"metadata": map[string]interface{}{"team": "core"}},
+		},
+		{
+			name:      "PATCH email drops stale email fields",
+			method:    http.MethodPatch,
+			body:      `{"email": "ada@example.com"}`,
+			wantSet:   bson.M{"email": "ada@example.com"},
+			wantUnset: bson.M{"email_raw": "", "email_hash": ""},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var update bson.M
+			var err error
+			if tt.method == http.MethodPut {
+				var req replacePostRequest
+				if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+					t.Fatal(err)
+				}
+				update, err = replaceUpdate(req)
+			} else {
+				var req patchPostRequest
+				if err := json.Unmarshal([]byte(tt.body), &req); err != nil {
+					t.Fatal(err)
+				}
+				update, err = patchUpdate(req)
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			set, _ := update["$set"].(bson.M)
+			if _, ok := set["updated_at"]; !ok {
+				t.Error("updated_at not set")
+			}
+			delete(set, "updated_at")
+			if !reflect.DeepEqual(set, tt.wantSet) {
+				t.Errorf("$set = %v, want %v", set, tt.wantSet)
+			}
+			unset, _ := update["$unset"].(bson.M)
+			if len(unset) != len(tt.wantUnset) || (len(unset) > 0 && !reflect.DeepEqual(unset, tt.wantUnset)) {
+				t.Errorf("$unset = %v, want %v", unset, tt.wantUnset)
+			}
+		})
+	}
+}
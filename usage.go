@@ -0,0 +1,144 @@
+package main
+
+import (
+	"context"
+	"log"
+	"net/http"
+	"strconv"
+
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+)
+
+const (
+	defaultUsageLimit = 50
+	maxUsageLimit     = 500
+)
+
+// userUsage is the storage used by one email address
+type userUsage struct {
+	Email       string `bson:"email" json:"email"`
+	TotalBytes  int64  `bson:"total_bytes" json:"total_bytes"`
+	ObjectCount int64  `bson:"object_count" json:"object_count"`
+}
+
+// usageTotals is the storage used across every email address
+type usageTotals struct {
+	TotalBytes  int64 `bson:"total_bytes" json:"total_bytes"`
+	ObjectCount int64 `bson:"object_count" json:"object_count"`
+}
+
+// contentTypeCount is one entry of GET /admin/posts/content-types
+type contentTypeCount struct {
+	ContentType string `bson:"_id" json:"content_type"`
+	Count       int64  `bson:"count" json:"count"`
+}
+
+// fetchUsage handles GET requests for storage usage grouped by email, heaviest users first
+func fetchUsage(c *gin.Context) {
+	limit := int64(defaultUsageLimit)
+	if value := c.Query("limit"); value != "" {
+		parsed, err := strconv.ParseInt(value, 10, 64)
+		if err != nil || parsed < 1 {
+			recordError(c, errorCategoryValidation)
+			respondError(c, http.StatusBadRequest, codeInvalidRequest, "limit must be a positive integer")
+			return
+		}
+		limit = min(parsed, maxUsageLimit)
+	}
+	sortField := "total_bytes"
+	switch c.DefaultQuery("sort", "bytes") {
+	case "bytes":
+	case "count":
+		sortField = "object_count"
+	default:
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "sort must be bytes or count")
+		return
+	}
+
+	sums := bson.M{"total_bytes": bson.M{"$sum": "$size_bytes"}, "object_count": bson.M{"$sum": 1}}
+	// Encrypted emails differ on every post, so with ENCRYPT_PII users are grouped by email_hash
+	var groupKey any = "$email"
+	if encryptPII {
+		groupKey = bson.M{"$ifNull": bson.A{"$email_hash", "$email"}}
+	}
+	byEmail := bson.M{"_id": groupKey, "email": bson.M{"$first": "$email"}}
+	grandTotal := bson.M{"_id": nil}
+	for key, value := range sums {
+		byEmail[key] = value
+		grandTotal[key] = value
+	}
+	pipeline := bson.A{
+		bson.M{"$facet": bson.M{
+			"users": bson.A{
+				bson.M{"$group": byEmail},
+				bson.M{"$sort": bson.D{{Key: sortField, Value: -1}, {Key: "_id", Value: 1}}},
+				bson.M{"$limit": limit},
+			},
+			"totals": bson.A{bson.M{"$group": grandTotal}},
+		}},
+	}
+
+	cursor, err := postsCollectionFor(c.Request.Context()).Aggregate(c.Request.Context(), pipeline)
+	if err != nil {
+		log.Printf("Error aggregating usage in MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	var results []struct {
+		Users  []userUsage   `bson:"users"`
+		Totals []usageTotals `bson:"totals"`
+	}
+	if err := cursor.All(c.Request.Context(), &results); err != nil {
+		log.Printf("Error parsing data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to parse data from MongoDB")
+		return
+	}
+
+	users := []userUsage{}
+	var totals usageTotals
+	if len(results) > 0 {
+		if results[0].Users != nil {
+			users = results[0].Users
+		}
+		for i := range users {
+			users[i].Email = readEmail(users[i].Email)
+		}
+		if len(results[0].Totals) > 0 {
+			totals = results[0].Totals[0]
+		}
+	}
+	respondList(c, http.StatusOK, "users", users, gin.H{"total": totals})
+}
+
+// fetchContentTypes handles GET requests for the distinct stored content types with their
+// post counts, most common first; posts without a content_type are left out
+func fetchContentTypes(c *gin.Context) {
+	pipeline := bson.A{
+		bson.M{"$match": bson.M{"content_type": bson.M{"$exists": true, "$ne": ""}}},
+		bson.M{"$group": bson.M{"_id": "$content_type", "count": bson.M{"$sum": 1}}},
+		bson.M{"$sort": bson.D{{Key: "count", Value: -1}, {Key: "_id", Value: 1}}},
+	}
+	cursor, err := postsCollectionFor(c.Request.Context()).Aggregate(c.Request.Context(), pipeline)
+	if err != nil {
+		log.Printf("Error aggregating content types in MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	counts := []contentTypeCount{}
+	if err := cursor.All(c.Request.Context(), &counts); err != nil {
+		log.Printf("Error parsing data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to parse data from MongoDB")
+		return
+	}
+	respond(c, http.StatusOK, counts, gin.H{"count": len(counts)})
+}
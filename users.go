@@ -0,0 +1,68 @@
+package main
+
+import (
+	"log"
+	"net/http"
+	"net/mail"
+	"strconv"
+	"strings"
+
+	"github.com/gin-gonic/gin"
+)
+
+// validEmail reports whether value is a bare email address
+func validEmail(value string) bool {
+	address, err := mail.ParseAddress(value)
+	return err == nil && address.Address == value
+}
+
+// gmailDomains are the domains whose addresses ignore dots and +suffixes in the local part
+var gmailDomains = []string{"gmail.com", "googlemail.com"}
+
+// normalizeEmail trims and lowercases an email when NORMALIZE_EMAILS is on, and with
+// NORMALIZE_GMAIL also drops the dots and +suffix Gmail ignores, so one mailbox is one email
+func normalizeEmail(email string) string {
+	if !normalizeEmails {
+		return email
+	}
+	email = strings.ToLower(strings.TrimSpace(email))
+	local, domain, ok := strings.Cut(email, "@")
+	if !ok || !normalizeGmail || !containsString(gmailDomains, domain) {
+		return email
+	}
+	local, _, _ = strings.Cut(local, "+")
+	return strings.ReplaceAll(local, ".", "") + "@gmail.com"
+}
+
+// fetchUserPosts handles GET requests to fetch one user's posts, paginated, with their total count
+func fetchUserPosts(c *gin.Context) {
+	email := c.Param("email")
+	if !validEmail(email) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid email address")
+		return
+	}
+	email = normalizeEmail(email)
+	page, ok := parsePagination(c)
+	if !ok {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid pagination parameters")
+		return
+	}
+
+	results, total, err := findPostsPage(c.Request.Context(), postsCollectionFor(c.Request.Context()), emailMatch(email), page)
+	if err != nil {
+		log.Printf("Error fetching user posts from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	c.Header("X-Total-Count", strconv.FormatInt(total, 10))
+	respondList(c, http.StatusOK, "posts", toPostResponses(results), gin.H{
+		"email": email,
+		"total": total,
+		"page":  page.Page,
+		"limit": page.Limit,
+	})
+}
@@ -0,0 +1,127 @@
+package main
+
+import (
+	"net"
+	"path"
+	"path/filepath"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+// maxFilenameLength caps the stored original filename, in bytes
+const maxFilenameLength = 255
+
+// splitList splits a comma-separated setting into trimmed, non-empty entries
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		item = strings.TrimSpace(item)
+		if item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// parseList splits a comma-separated setting into trimmed, lowercased, non-empty entries
+func parseList(value string) []string {
+	items := splitList(value)
+	for i, item := range items {
+		items[i] = strings.ToLower(item)
+	}
+	return items
+}
+
+// parseExtensions parses a comma-separated extension list, normalizing each entry to a leading dot
+func parseExtensions(value string) []string {
+	extensions := parseList(value)
+	for i, ext := range extensions {
+		if !strings.HasPrefix(ext, ".") {
+			extensions[i] = "." + ext
+		}
+	}
+	return extensions
+}
+
+// containsString reports whether list contains value
+func containsString(list []string, value string) bool {
+	for _, item := range list {
+		if item == value {
+			return true
+		}
+	}
+	return false
+}
+
+// fileExtension returns the lowercased extension of a filename, including the dot
+func fileExtension(filename string) string {
+	return strings.ToLower(filepath.Ext(filename))
+}
+
+// mediaType strips parameters such as charset from a content type
+func mediaType(contentType string) string {
+	return strings.TrimSpace(strings.SplitN(contentType, ";", 2)[0])
+}
+
+// sanitizeFilename reduces a client-supplied file name to a base name that is safe to store
+// and to put in a Content-Disposition header: directories, control characters, quotes and
+// invalid UTF-8 are dropped, and long names are shortened keeping their extension
+func sanitizeFilename(name string) string {
+	name = strings.ToValidUTF8(name, "")
+	name = path.Base(strings.ReplaceAll(name, "\\", "/"))
+	name = strings.TrimSpace(strings.Map(func(r rune) rune {
+		if unicode.IsControl(r) || r == '"' {
+			return -1
+		}
+		return r
+	}, name))
+	if name == "." || name == ".." || name == "/" {
+		return ""
+	}
+	if len(name) <= maxFilenameLength {
+		return name
+	}
+	ext := path.Ext(name)
+	if len(ext) > 16 {
+		ext = ""
+	}
+	base := name[:maxFilenameLength-len(ext)]
+	for !utf8.ValidString(base) {
+		base = base[:len(base)-1]
+	}
+	return base + ext
+}
+
+// extensionAllowed reports whether the filename's extension passes ALLOWED_EXTENSIONS;
+// an empty list allows every extension
+func extensionAllowed(filename string) bool {
+	return len(allowedExtensions) == 0 || containsString(allowedExtensions, fileExtension(filename))
+}
+
+// extensionBlocked reports whether any extension in the filename is on BLOCKED_EXTENSIONS.
+// Inner extensions count too, so "shell.php.jpg" is caught by a blocked ".php".
+func extensionBlocked(filename string) bool {
+	parts := strings.Split(strings.ToLower(filepath.Base(filename)), ".")
+	for _, part := range parts[1:] {
+		if containsString(blockedExtensions, "."+strings.TrimSpace(part)) {
+			return true
+		}
+	}
+	return false
+}
+
+// contentTypeAllowed reports whether the sniffed content type passes ALLOWED_MIME_TYPES;
+// an empty list allows every type
+func contentTypeAllowed(contentType string) bool {
+	return len(allowedMIMETypes) == 0 || containsString(allowedMIMETypes, mediaType(contentType))
+}
+
+// validIPOrCIDR reports whether value is an IP address or a CIDR range
+func validIPOrCIDR(value string) bool {
+	if net.ParseIP(value) != nil {
+		return true
+	}
+	_, _, err := net.ParseCIDR(value)
+	return err == nil
+}
@@ -0,0 +1,59 @@
+package main
+
+import "testing"
+
+func TestExtensionAllowed(t *testing.T) {
+	tests := []struct {
+		name     string
+		allowed  string
+		filename string
+		want     bool
+	}{
+		{"no list allows everything", "", "notes.exe", true},
+		{"listed extension", "jpg,png", "photo.jpg", true},
+		{"listed with leading dot", ".jpg,.png", "photo.png", true},
+		{"case insensitive", "JPG", "PHOTO.Jpg", true},
+		{"unlisted extension", "jpg,png", "script.php", false},
+		{"only the last extension counts", "jpg", "photo.jpg.php", false},
+		{"no extension", "jpg", "photo", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := allowedExtensions
+			allowedExtensions = parseExtensions(tt.allowed)
+			defer func() { allowedExtensions = previous }()
+
+			if got := extensionAllowed(tt.filename); got != tt.want {
+				t.Errorf("extensionAllowed(%q) with %q = %v, want %v", tt.filename, tt.allowed, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestExtensionBlocked(t *testing.T) {
+	tests := []struct {
+		name     string
+		blocked  string
+		filename string
+		want     bool
+	}{
+		{"no list blocks nothing", "", "shell.php", false},
+		{"allowed extension", "php,exe", "photo.jpg", false},
+		{"blocked extension", "php,exe", "shell.php", true},
+		{"case insensitive", "PHP", "Shell.PhP", true},
+		{"blocked inner extension", "php", "shell.php.jpg", true},
+		{"directories are ignored", "php", "uploads.php/photo.jpg", false},
+		{"blocked name without the dot", "php", "php", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			previous := blockedExtensions
+			blockedExtensions = parseExtensions(tt.blocked)
+			defer func() { blockedExtensions = previous }()
+
+			if got := extensionBlocked(tt.filename); got != tt.want {
+				t.Errorf("extensionBlocked(%q) with %q = %v, want %v", tt.filename, tt.blocked, got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,150 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"strings"
+
+	"github.com/aws/aws-sdk-go/aws"
+	"github.com/aws/aws-sdk-go/service/s3"
+	"github.com/gin-gonic/gin"
+	"go.mongodb.org/mongo-driver/bson"
+	"go.mongodb.org/mongo-driver/bson/primitive"
+	"go.mongodb.org/mongo-driver/mongo"
+)
+
+// verifyResult describes how a stored post compares with its S3 object
+type verifyResult struct {
+	ID          string `json:"id"`
+	Exists      bool   `json:"exists"`
+	SizeMatches *bool  `json:"size_matches"`
+	ETagMatches *bool  `json:"etag_matches"`
+}
+
+// consistent reports whether the object exists and every comparable attribute matches
+func (r verifyResult) consistent() bool {
+	return r.Exists && (r.SizeMatches == nil || *r.SizeMatches) && (r.ETagMatches == nil || *r.ETagMatches)
+}
+
+// verifyPostObject compares a post document against its object in S3 using HeadObject.
+// Size and ETag comparisons are nil when there is nothing comparable, as with multipart ETags.
+func verifyPostObject(ctx context.Context, doc postDocument) (verifyResult, error) {
+	result := verifyResult{ID: doc.ID.Hex()}
+
+	head, err := s3Session.HeadObjectWithContext(ctx, &s3.HeadObjectInput{
+		Bucket: aws.String(bucket),
+		Key:    aws.String(objectKeyFor(doc)),
+	})
+	if isNotFound(err) {
+		return result, nil
+	}
+	if err != nil {
+		return result, err
+	}
+	result.Exists = true
+
+	if doc.SizeBytes > 0 {
+		matches := aws.Int64Value(head.ContentLength) == doc.SizeBytes
+		result.SizeMatches = &matches
+	}
+	// Multipart uploads get an "<md5>-<parts>" ETag, which is not the MD5 of the whole object
+	if etag := trimETag(aws.StringValue(head.ETag)); doc.ContentMD5 != "" && !strings.Contains(etag, "-") {
+		matches := etag == doc.ContentMD5
+		result.ETagMatches = &matches
+	}
+	return result, nil
+}
+
+// verifyPost handles GET requests to check that a post's object still exists in S3
+func verifyPost(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Verification requires the S3 storage backend")
+		return
+	}
+
+	id, err := primitive.ObjectIDFromHex(c.Param("id"))
+	if err != nil {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusBadRequest, codeInvalidRequest, "Invalid post ID")
+		return
+	}
+
+	var doc postDocument
+	err = postsCollectionFor(c.Request.Context()).FindOne(c.Request.Context(), bson.M{"_id": id}).Decode(&doc)
+	if errors.Is(err, mongo.ErrNoDocuments) {
+		recordError(c, errorCategoryValidation)
+		respondError(c, http.StatusNotFound, codeNotFound, "Post not found")
+		return
+	}
+	if err != nil {
+		log.Printf("Error fetching post from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	result, err := verifyPostObject(c.Request.Context(), doc)
+	if err != nil {
+		log.Printf("Error verifying object in S3: %v", err)
+		recordError(c, errorCategoryS3)
+		respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to verify object in S3")
+		return
+	}
+
+	respond(c, http.StatusOK, result, nil)
+}
+
+// verifyAllPosts handles POST requests to verify every post, returning the inconsistent ones
+func verifyAllPosts(c *gin.Context) {
+	if storageBackend != "s3" {
+		respondError(c, http.StatusNotImplemented, codeNotImplemented, "Verification requires the S3 storage backend")
+		return
+	}
+
+	ctx := c.Request.Context()
+
+	cursor, err := postsCollectionFor(ctx).Find(ctx, bson.M{})
+	if err != nil {
+		log.Printf("Error fetching data from MongoDB: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+	defer cursor.Close(context.TODO())
+
+	checked := 0
+	inconsistent := []verifyResult{}
+	for cursor.Next(ctx) {
+		var doc postDocument
+		if err := cursor.Decode(&doc); err != nil {
+			log.Printf("Error parsing data from MongoDB: %v", err)
+			continue
+		}
+		result, err := verifyPostObject(ctx, doc)
+		if err != nil {
+			log.Printf("Error verifying object in S3: %v", err)
+			recordError(c, errorCategoryS3)
+			respondError(c, http.StatusInternalServerError, codeS3Failure, "Failed to verify object in S3")
+			return
+		}
+		checked++
+		if !result.consistent() {
+			inconsistent = append(inconsistent, result)
+		}
+	}
+	if err := cursor.Err(); err != nil {
+		log.Printf("Error iterating posts for verification: %v", err)
+		recordError(c, errorCategoryMongo)
+		respondError(c, http.StatusInternalServerError, codeMongoFailure, "Failed to fetch data from MongoDB")
+		return
+	}
+
+	respondList(c, http.StatusOK, "inconsistent", inconsistent, gin.H{"checked": checked})
+}
+
+// trimETag strips the quotes S3 puts around ETag values
+func trimETag(etag string) string {
+	return strings.Trim(etag, `"`)
+}
@@ -0,0 +1,51 @@
+package main
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"path/filepath"
+	"strings"
+
+	"github.com/HugoSmits86/nativewebp"
+	"github.com/disintegration/imaging"
+
+	// Registers the WebP decoder so converted uploads can be measured and thumbnailed
+	_ "golang.org/x/image/webp"
+)
+
+// webpSourceTypes lists the content types CONVERT_TO_WEBP re-encodes. GIFs are left alone
+// because decoding keeps only the first frame of an animation.
+var webpSourceTypes = []string{"image/jpeg", "image/png", "image/bmp"}
+
+// convertToWebP re-encodes a raster image as lossless WebP and rewinds the result.
+// The original is returned with converted false when it is not convertible or
+// when the WebP encoding would be larger.
+func convertToWebP(file io.ReadSeeker, contentType string, size int64) (out io.ReadSeeker, outSize int64, converted bool, err error) {
+	if !containsString(webpSourceTypes, mediaType(contentType)) {
+		return file, size, false, nil
+	}
+
+	img, err := imaging.Decode(file)
+	if err != nil {
+		return nil, 0, false, err
+	}
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, 0, false, err
+	}
+
+	var buf bytes.Buffer
+	if err := nativewebp.Encode(&buf, img, nil); err != nil {
+		return nil, 0, false, err
+	}
+	if int64(buf.Len()) >= size {
+		log.Printf("Skipping WebP conversion of %s image: %d bytes would grow to %d", contentType, size, buf.Len())
+		return file, size, false, nil
+	}
+	return bytes.NewReader(buf.Bytes()), int64(buf.Len()), true, nil
+}
+
+// webpFilename swaps the extension of a file name for .webp
+func webpFilename(name string) string {
+	return strings.TrimSuffix(name, filepath.Ext(name)) + ".webp"
+}